@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LLMBackend runs patterns against a model and lists the patterns and models
+// it can run
+type LLMBackend interface {
+	// Name identifies the backend in logs and run records
+	Name() string
+	// RunPattern runs a pattern over input, calling onChunk (if not nil) with output as it arrives
+	RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error)
+	ListPatterns(ctx context.Context) ([]string, error)
+	ListModels(ctx context.Context) ([]Model, error)
+}
+
+// VersionedBackend is implemented by backends that can report the version of
+// the fabric install they run, which is recorded with every run
+type VersionedBackend interface {
+	Version(ctx context.Context) (string, error)
+}
+
+// ChatBackend is implemented by backends that take a whole conversation
+// rather than a pattern and a single input. Other backends get conversations
+// flattened into one input run without a pattern.
+type ChatBackend interface {
+	Chat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string)) (string, error)
+}
+
+// ExecBackend runs the fabric binary found on PATH
+type ExecBackend struct{}
+
+func (ExecBackend) Name() string {
+	return "fabric"
+}
+
+func (ExecBackend) RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
+	return RunFabricStream(ctx, input, pattern, model, onChunk)
+}
+
+func (ExecBackend) Version(ctx context.Context) (string, error) {
+	return FabricVersion(ctx)
+}
+
+func (ExecBackend) ListPatterns(ctx context.Context) ([]string, error) {
+	return ListPatterns()
+}
+
+func (ExecBackend) ListModels(ctx context.Context) ([]Model, error) {
+	return ListModels()
+}
+
+type backendUsedKey struct{}
+
+// withBackendUsed returns a context under which backends that hand a run to
+// another backend, such as FallbackBackend, call report with the backend that
+// actually ran it
+func withBackendUsed(ctx context.Context, report func(LLMBackend)) context.Context {
+	return context.WithValue(ctx, backendUsedKey{}, report)
+}
+
+func reportBackendUsed(ctx context.Context, backend LLMBackend) {
+	if report, ok := ctx.Value(backendUsedKey{}).(func(LLMBackend)); ok {
+		report(backend)
+	}
+}
+
+// FallbackBackend uses its primary backend and switches to the fallback
+// whenever the primary fails. A run that already streamed output is not
+// retried, since its output has been seen. Runs that fall back are recorded
+// under the fallback's name.
+type FallbackBackend struct {
+	Primary  LLMBackend
+	Fallback LLMBackend
+	Logger   *slog.Logger
+}
+
+func (b *FallbackBackend) Name() string {
+	return b.Primary.Name()
+}
+
+func (b *FallbackBackend) RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
+	streamed := false
+	trackingChunk := onChunk
+	if onChunk != nil {
+		trackingChunk = func(chunk string) {
+			streamed = true
+			onChunk(chunk)
+		}
+	}
+	output, err := b.Primary.RunPattern(ctx, input, pattern, model, trackingChunk)
+	if err == nil || streamed || ctx.Err() != nil {
+		return output, err
+	}
+	b.Logger.Warn("Backend failed, falling back", "backend", b.Primary.Name(), "fallback", b.Fallback.Name(), "error", err)
+	reportBackendUsed(ctx, b.Fallback)
+	return b.Fallback.RunPattern(ctx, input, pattern, model, onChunk)
+}
+
+// Version reports the primary backend's version, if it has one
+func (b *FallbackBackend) Version(ctx context.Context) (string, error) {
+	versioned, ok := b.Primary.(VersionedBackend)
+	if !ok {
+		return "", nil
+	}
+	return versioned.Version(ctx)
+}
+
+func (b *FallbackBackend) ListPatterns(ctx context.Context) ([]string, error) {
+	patterns, err := b.Primary.ListPatterns(ctx)
+	if err == nil {
+		return patterns, nil
+	}
+	b.Logger.Warn("Backend failed to list patterns, falling back", "backend", b.Primary.Name(), "error", err)
+	return b.Fallback.ListPatterns(ctx)
+}
+
+func (b *FallbackBackend) ListModels(ctx context.Context) ([]Model, error) {
+	models, err := b.Primary.ListModels(ctx)
+	if err == nil {
+		return models, nil
+	}
+	b.Logger.Warn("Backend failed to list models, falling back", "backend", b.Primary.Name(), "error", err)
+	return b.Fallback.ListModels(ctx)
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubBackend answers every pattern with output, or fails with err
+type stubBackend struct {
+	name    string
+	output  string
+	err     error
+	version string
+
+	runs, versionCalls, modelCalls int
+}
+
+func (b *stubBackend) Name() string {
+	return b.name
+}
+
+func (b *stubBackend) RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
+	b.runs++
+	if b.err != nil {
+		return "", b.err
+	}
+	if onChunk != nil {
+		onChunk(b.output)
+	}
+	return b.output, nil
+}
+
+func (b *stubBackend) Version(ctx context.Context) (string, error) {
+	b.versionCalls++
+	return b.version, nil
+}
+
+func (b *stubBackend) ListPatterns(ctx context.Context) ([]string, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return []string{b.name + "_pattern"}, nil
+}
+
+func (b *stubBackend) ListModels(ctx context.Context) ([]Model, error) {
+	b.modelCalls++
+	if b.err != nil {
+		return nil, b.err
+	}
+	return []Model{{Provider: b.name, Name: b.name + "-model"}}, nil
+}
+
+func TestRunRecordsBackendUsed(t *testing.T) {
+	tests := []struct {
+		name        string
+		primaryErr  error
+		wantBackend string
+		wantVersion string
+	}{
+		{"primary", nil, "primary", "1.0"},
+		{"fell back", errors.New("unreachable"), "fallback", "2.0"},
+	}
+	for _, tt := range tests {
+		p, _ := newTestProcessor(t)
+		p.SetBackend(&FallbackBackend{
+			Primary:  &stubBackend{name: "primary", output: "from primary", err: tt.primaryErr, version: "1.0"},
+			Fallback: &stubBackend{name: "fallback", output: "from fallback", version: "2.0"},
+			Logger:   testLogger(),
+		})
+		run, _, err := p.recordRun(context.Background(), "aaaaaaaaaaa", "summarize", "default", "input", func(ctx context.Context, run *Run) (string, error) {
+			return p.backend.RunPattern(ctx, "input", run.Pattern, run.Model, nil)
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if run.Backend != tt.wantBackend || run.FabricVersion != tt.wantVersion {
+			t.Errorf("%s: run recorded backend %q version %q, want %q version %q", tt.name, run.Backend, run.FabricVersion, tt.wantBackend, tt.wantVersion)
+		}
+	}
+}
+
+func TestRunsReuseBackendInfo(t *testing.T) {
+	p, _ := newTestProcessor(t)
+	backend := &stubBackend{name: "stub", output: "output", version: "1.0"}
+	p.SetBackend(backend)
+	for i := 0; i < 3; i++ {
+		run, _, err := p.recordRun(context.Background(), "aaaaaaaaaaa", "summarize", "stub-model", "input", func(ctx context.Context, run *Run) (string, error) {
+			return p.backend.RunPattern(ctx, "input", run.Pattern, run.Model, nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.Provider != "stub" || run.FabricVersion != "1.0" {
+			t.Errorf("run %d recorded provider %q version %q", i, run.Provider, run.FabricVersion)
+		}
+	}
+	if backend.modelCalls != 1 || backend.versionCalls != 1 {
+		t.Errorf("looked up models %d times and the version %d times over 3 runs, want once each", backend.modelCalls, backend.versionCalls)
+	}
+}
+
+// blockingModelsBackend blocks listing models until release is closed
+type blockingModelsBackend struct {
+	stubBackend
+	listing, release chan struct{}
+}
+
+func (b *blockingModelsBackend) ListModels(ctx context.Context) ([]Model, error) {
+	close(b.listing)
+	<-b.release
+	return b.stubBackend.ListModels(ctx)
+}
+
+func TestBackendInfoLookupsDoNotBlock(t *testing.T) {
+	p, _ := newTestProcessor(t)
+	backend := &blockingModelsBackend{
+		stubBackend: stubBackend{name: "stub", version: "1.0"},
+		listing:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+	p.SetBackend(backend)
+
+	provider := make(chan string)
+	go func() { provider <- p.providerFor(context.Background(), "stub-model") }()
+	<-backend.listing
+
+	// The version is looked up while the provider lookup is still waiting
+	done := make(chan string)
+	go func() { done <- p.backendVersion(context.Background(), backend) }()
+	select {
+	case version := <-done:
+		if version != "1.0" {
+			t.Errorf("version = %q", version)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("version lookup waited for the provider lookup")
+	}
+
+	close(backend.release)
+	if got := <-provider; got != "stub" {
+		t.Errorf("provider = %q, want stub", got)
+	}
+}
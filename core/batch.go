@@ -0,0 +1,174 @@
+package core
+
+import (
+	"fabric-agents/yt"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VideoFilter narrows the video list. Empty fields match everything.
+type VideoFilter struct {
+	// Query is a search query matched against titles, channels, transcripts
+	// and outputs through the search index
+	Query        string
+	CollectionID string
+	Channel      string
+	Tag          string
+}
+
+// FilterVideos returns the videos matching the filter, keeping their order
+func (p *Processor) FilterVideos(videos []yt.Video, filter VideoFilter) ([]yt.Video, error) {
+	var members map[string]bool
+	if filter.CollectionID != "" {
+		collection, err := p.LoadCollection(filter.CollectionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load collection: %v", err)
+		}
+		members = make(map[string]bool, len(collection.VideoIDs))
+		for _, videoID := range collection.VideoIDs {
+			members[videoID] = true
+		}
+	}
+	var tagged map[string]bool
+	if filter.Tag != "" {
+		all, err := p.store.LoadAllTags()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tags: %v", err)
+		}
+		tagged = make(map[string]bool)
+		for _, videoID := range all[filter.Tag] {
+			tagged[videoID] = true
+		}
+	}
+	var found map[string]bool
+	if strings.TrimSpace(filter.Query) != "" {
+		found = p.search.MatchingVideos(filter.Query)
+	}
+
+	var matched []yt.Video
+	for _, video := range videos {
+		if members != nil && !members[video.ID] {
+			continue
+		}
+		if filter.Channel != "" && video.Channel != filter.Channel {
+			continue
+		}
+		if tagged != nil && !tagged[video.ID] {
+			continue
+		}
+		if strings.TrimSpace(filter.Query) != "" && !found[video.ID] {
+			continue
+		}
+		matched = append(matched, video)
+	}
+	return matched, nil
+}
+
+// VideoChannels returns the distinct channels of the videos, sorted
+func VideoChannels(videos []yt.Video) []string {
+	seen := make(map[string]bool)
+	var channels []string
+	for _, video := range videos {
+		if video.Channel != "" && !seen[video.Channel] {
+			seen[video.Channel] = true
+			channels = append(channels, video.Channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Batch item states besides the queued job's own state
+const (
+	BatchQueued = "queued"
+	// BatchPending is a video already queued or running with the same pattern and model
+	BatchPending = "pending"
+	BatchSkipped = "skipped"
+	BatchFailed  = "failed"
+)
+
+// BatchItem reports what a batch run did with one video
+type BatchItem struct {
+	VideoID string
+	Title   string
+	Status  string
+	// JobID is set for queued and pending videos
+	JobID string
+	// Existing links to the output that made a video be skipped
+	Existing string
+	Error    string
+}
+
+// BatchProcess queues a process job for each video. Videos that already have
+// a successful output of the pattern and model are skipped unless force is
+// set; videos with a job of the same pattern and model still queued or
+// running are never queued again.
+func (p *Processor) BatchProcess(videos []yt.Video, pattern string, model string, force bool) []BatchItem {
+	p.logger.Info("Batch processing videos", "count", len(videos), "pattern", pattern, "model", model, "force", force)
+	pending := make(map[string]string)
+	for _, job := range p.jobs.List() {
+		if job.Kind == JobProcess && !job.State.Done() && job.Params["pattern"] == pattern && job.Params["model"] == model {
+			pending[job.Params["videoID"]] = job.ID
+		}
+	}
+
+	items := make([]BatchItem, 0, len(videos))
+	for _, video := range videos {
+		item := BatchItem{VideoID: video.ID, Title: video.Title}
+		if jobID, ok := pending[video.ID]; ok {
+			item.Status = BatchPending
+			item.JobID = jobID
+			items = append(items, item)
+			continue
+		}
+		if !force {
+			existing, err := p.FindOutput(video.ID, pattern, model)
+			if err != nil {
+				p.logger.Warn("Failed to check for existing output", "videoID", video.ID, "error", err)
+			}
+			if existing != "" {
+				item.Status = BatchSkipped
+				item.Existing = existing
+				items = append(items, item)
+				continue
+			}
+		}
+		job, err := p.EnqueueProcess(video.ID, model, pattern)
+		if err != nil {
+			item.Status = BatchFailed
+			item.Error = err.Error()
+		} else {
+			item.Status = BatchQueued
+			item.JobID = job.ID
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// FindOutput returns the link of a successful output of the pattern and model
+// for a video, or "" when there is none. Output files saved before runs were
+// recorded count too.
+func (p *Processor) FindOutput(videoID string, pattern string, model string) (string, error) {
+	runs, _, err := p.store.LoadRuns(videoID)
+	if err != nil {
+		return "", err
+	}
+	for _, run := range runs {
+		if run.Pattern == pattern && run.Model == model && run.Status == RunSucceeded {
+			return fmt.Sprintf("/videos/%s/runs/%s", videoID, run.ID), nil
+		}
+	}
+	file := OutputName(pattern, model)
+	outputs, err := p.store.LoadOutputs(videoID)
+	if err != nil {
+		return "", err
+	}
+	for _, output := range outputs {
+		if output == file {
+			return fmt.Sprintf("/videos/%s/%s", videoID, file), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fabric-agents/yt"
+)
+
+// newBatchTest returns a processor with three indexed videos and a job
+// queue that is never started, so queued jobs stay queued
+func newBatchTest(t *testing.T) (*Processor, []yt.Video) {
+	t.Helper()
+	p, _ := newTestProcessor(t)
+	p.RegisterJobs(NewJobQueue(testLogger(), p.Store(), 1))
+	videos := []yt.Video{
+		{ID: "aaaaaaaaaa1", Title: "Intro to Rust", Channel: "Systems", Transcript: "Ownership and borrowing."},
+		{ID: "bbbbbbbbbb2", Title: "Gardening", Channel: "Outdoors", Transcript: "Tomatoes need sun."},
+		{ID: "cccccccccc3", Title: "Cooking", Channel: "Outdoors", Transcript: "Grill the vegetables."},
+	}
+	for _, video := range videos {
+		if err := p.Store().SaveVideo(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := Run{ID: "20260101-120000-00000001", VideoID: "cccccccccc3", Pattern: "summarize", Model: "default",
+		RunRecord: RunRecord{Status: RunSucceeded, StartedAt: time.Now()}}
+	if err := p.Store().SaveRun(run, "A summary about borrowing tools."); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.BuildSearchIndex(); err != nil {
+		t.Fatal(err)
+	}
+	return p, videos
+}
+
+func TestFilterVideos(t *testing.T) {
+	p, videos := newBatchTest(t)
+	if err := p.Store().SaveTags("bbbbbbbbbb2", []string{"weekend"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		filter VideoFilter
+		want   string
+	}{
+		{"everything", VideoFilter{}, "aaaaaaaaaa1 bbbbbbbbbb2 cccccccccc3"},
+		{"title", VideoFilter{Query: "rust"}, "aaaaaaaaaa1"},
+		{"channel", VideoFilter{Query: "OUTDOORS"}, "bbbbbbbbbb2 cccccccccc3"},
+		{"transcript", VideoFilter{Query: "tomatoes"}, "bbbbbbbbbb2"},
+		{"transcript and output", VideoFilter{Query: "borrowing"}, "aaaaaaaaaa1 cccccccccc3"},
+		{"every term", VideoFilter{Query: "borrowing tools"}, "cccccccccc3"},
+		{"no match", VideoFilter{Query: "quantum"}, ""},
+		{"query and channel", VideoFilter{Query: "borrowing", Channel: "Outdoors"}, "cccccccccc3"},
+		{"tag", VideoFilter{Tag: "weekend"}, "bbbbbbbbbb2"},
+	}
+	for _, tt := range tests {
+		matched, err := p.FilterVideos(videos, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var ids []string
+		for _, video := range matched {
+			ids = append(ids, video.ID)
+		}
+		if got := strings.Join(ids, " "); got != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBatchProcess(t *testing.T) {
+	p, videos := newBatchTest(t)
+
+	items := p.BatchProcess(videos, "summarize", "default", false)
+	statuses := func(items []BatchItem) string {
+		var s []string
+		for _, item := range items {
+			s = append(s, item.Status)
+		}
+		return strings.Join(s, " ")
+	}
+	if got := statuses(items); got != "queued queued skipped" {
+		t.Fatalf("first batch = %q, want the video with an output skipped", got)
+	}
+	if items[2].Existing != "/videos/cccccccccc3/runs/20260101-120000-00000001" {
+		t.Errorf("skipped item links to %q", items[2].Existing)
+	}
+
+	// The jobs queued above are still pending, so forcing a second batch
+	// only queues the video that was skipped
+	again := p.BatchProcess(videos, "summarize", "default", true)
+	if got := statuses(again); got != "pending pending queued" {
+		t.Errorf("second batch = %q", got)
+	}
+	if again[0].JobID != items[0].JobID {
+		t.Errorf("pending item points at job %q, want %q", again[0].JobID, items[0].JobID)
+	}
+
+	// Another model is a different job
+	if got := statuses(p.BatchProcess(videos[:1], "summarize", "other", false)); got != "queued" {
+		t.Errorf("batch with another model = %q", got)
+	}
+	if queued := len(p.jobs.List()); queued != 4 {
+		t.Errorf("%d jobs queued, want 4", queued)
+	}
+}
@@ -0,0 +1,412 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"fabric-agents/yt"
+)
+
+// JobChat is the job kind answering a question in a chat about a video
+const JobChat = "chat"
+
+// chatSystemPrompt tells the model how to answer questions about a video
+const chatSystemPrompt = `You answer questions about a video using its transcript, given below with the start time of each passage in square brackets.
+
+- Answer from the transcript. If it does not cover the question, say so rather than guessing.
+- Cite the moments you rely on with their timestamps in square brackets exactly as they appear, e.g. [12:30].
+- Keep answers concise and use Markdown.`
+
+// chatContextShare is the part of the input token limit the transcript may
+// take in a chat, leaving room for the conversation itself
+const chatContextShare = 0.75
+
+// Chat is a conversation about a video. Chats are stored under the video's
+// chats directory as <id>.json.
+type Chat struct {
+	ID        string     `json:"id"`
+	VideoID   string     `json:"video_id"`
+	Model     string     `json:"model"`
+	Messages  []ChatTurn `json:"messages"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ChatTurn is one question or answer of a chat
+type ChatTurn struct {
+	Role    string    `json:"role"`
+	Content string    `json:"content"`
+	Model   string    `json:"model,omitempty"`
+	At      time.Time `json:"at"`
+	// Context lists the start, in seconds, of the transcript windows sent
+	// with a question when the transcript was too long to send whole
+	Context []int `json:"context,omitempty"`
+}
+
+// Title returns the chat's first question, shortened
+func (c Chat) Title() string {
+	for _, turn := range c.Messages {
+		if turn.Role == "user" {
+			title := strings.Join(strings.Fields(turn.Content), " ")
+			if runes := []rune(title); len(runes) > 60 {
+				cut := string(runes[:60])
+				if i := strings.LastIndex(cut, " "); i > 0 {
+					cut = cut[:i]
+				}
+				title = cut + "…"
+			}
+			return title
+		}
+	}
+	return "New chat"
+}
+
+// EnqueueChat queues a job asking a question in a chat about a video. An
+// empty chatID starts a new chat.
+func (p *Processor) EnqueueChat(videoID string, chatID string, model string, question string) (Job, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return Job{}, fmt.Errorf("ask a question")
+	}
+	asked := Chat{Messages: []ChatTurn{{Role: "user", Content: question}}}
+	return p.jobs.Enqueue(JobChat, fmt.Sprintf("Ask about %s: %s", videoID, asked.Title()), map[string]string{
+		"videoID":  videoID,
+		"chatID":   chatID,
+		"model":    model,
+		"question": question,
+	})
+}
+
+func (p *Processor) runChatJob(ctx context.Context, job Job, progress func(string)) (string, error) {
+	videoID := job.Params["videoID"]
+	chat, err := p.AskVideo(ctx, videoID, job.Params["chatID"], job.Params["model"], job.Params["question"], progress)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/videos/%s/chat?chat=%s", videoID, chat.ID), nil
+}
+
+// AskVideo adds a question to a chat about a video and gets the answer
+// through the backend. An empty chatID starts a new chat. If onChunk is not
+// nil it receives the answer as it is generated. The transcript is sent as
+// context with every question; when it is longer than the input token
+// limit, only the windows most relevant to the conversation are sent.
+func (p *Processor) AskVideo(ctx context.Context, videoID string, chatID string, model string, question string, onChunk func(string)) (*Chat, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, fmt.Errorf("ask a question")
+	}
+	video, err := p.store.LoadVideo(videoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load video: %v", err)
+	}
+	if video == nil {
+		return nil, fmt.Errorf("video %s not found", videoID)
+	}
+
+	var chat *Chat
+	if chatID != "" {
+		chat, err = LoadChat(videoID, chatID, p.filesDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chat: %v", err)
+		}
+	} else {
+		id, err := newJobID()
+		if err != nil {
+			return nil, err
+		}
+		chat = &Chat{ID: id, VideoID: videoID, CreatedAt: time.Now()}
+	}
+	if model == "" {
+		model = chat.Model
+	}
+	if model == "" {
+		model = "default"
+	}
+	p.logger.Info("Asking about video", "videoID", videoID, "chatID", chat.ID, "model", model)
+
+	// Earlier questions help pick context for follow-ups like "why?"
+	query := question
+	for _, turn := range chat.Messages {
+		if turn.Role == "user" {
+			query += "\n" + turn.Content
+		}
+	}
+	transcript, windows := p.chatContext(ctx, *video, query)
+
+	system := fmt.Sprintf("%s\n\n# Video: %s\n\n", chatSystemPrompt, video.Title)
+	if video.Channel != "" {
+		system += fmt.Sprintf("Channel: %s\n\n", video.Channel)
+	}
+	system += transcript
+	messages := []ChatMessage{{Role: "system", Content: system}}
+	for _, turn := range chat.Messages {
+		messages = append(messages, ChatMessage{Role: turn.Role, Content: turn.Content})
+	}
+	messages = append(messages, ChatMessage{Role: "user", Content: question})
+
+	provider := p.providerFor(ctx, model)
+	release, err := p.providers.acquire(ctx, provider)
+	if err != nil {
+		return nil, fmt.Errorf("stopped while waiting for a free %s slot: %v", p.backend.Name(), err)
+	}
+	defer release()
+	asked := time.Now()
+	answer, err := p.withRunTimeout(ctx, func(ctx context.Context) (string, error) {
+		return p.chat(ctx, model, messages, onChunk)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get an answer: %v", err)
+	}
+
+	chat.Model = model
+	chat.UpdatedAt = time.Now()
+	chat.Messages = append(chat.Messages,
+		ChatTurn{Role: "user", Content: question, At: asked, Context: windows},
+		ChatTurn{Role: "assistant", Content: strings.TrimSpace(answer), Model: model, At: chat.UpdatedAt},
+	)
+	if err := SaveChat(*chat, p.filesDir); err != nil {
+		return nil, fmt.Errorf("failed to save chat: %v", err)
+	}
+	return chat, nil
+}
+
+// chat sends a conversation to the backend, flattening it into a single
+// input for backends that only run patterns
+func (p *Processor) chat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string)) (string, error) {
+	if chatBackend, ok := p.backend.(ChatBackend); ok {
+		return chatBackend.Chat(ctx, model, messages, onChunk)
+	}
+	var input strings.Builder
+	for _, message := range messages {
+		switch message.Role {
+		case "system":
+			input.WriteString(message.Content)
+		case "user":
+			fmt.Fprintf(&input, "\n\n## Question\n\n%s", message.Content)
+		case "assistant":
+			fmt.Fprintf(&input, "\n\n## Your answer\n\n%s", message.Content)
+		}
+	}
+	input.WriteString("\n\n## Your answer\n\n")
+	return p.backend.RunPattern(ctx, input.String(), "", model, onChunk)
+}
+
+// chatContext formats a video's transcript with timestamps. When it does not
+// fit the input token limit, only the windows most relevant to the query are
+// kept, in order, and their starts are returned.
+func (p *Processor) chatContext(ctx context.Context, video yt.Video, query string) (string, []int) {
+	windows := transcriptWindows(video)
+	lines := make([]string, len(windows))
+	total := 0
+	for i, window := range windows {
+		lines[i] = strings.TrimSpace(window.Text)
+		// Windows of transcripts without timings all start at 0
+		if len(video.Segments) > 0 {
+			lines[i] = fmt.Sprintf("[%s] %s", formatTimestamp(window.Start), lines[i])
+		}
+		total += EstimateTokens(lines[i])
+	}
+	budget := int(float64(p.maxInputTokens) * chatContextShare)
+	if p.maxInputTokens <= 0 || total <= budget {
+		return strings.Join(lines, "\n"), nil
+	}
+
+	scores := p.windowScores(ctx, video.ID, windows, query)
+	order := make([]int, len(windows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	var picked []int
+	used := 0
+	for _, i := range order {
+		// Each window also costs a line break and maybe a gap marker
+		tokens := EstimateTokens(lines[i]) + 2
+		if used+tokens > budget {
+			if len(picked) > 0 {
+				continue
+			}
+			// The best window alone is over budget, so send as much of it as fits
+			lines[i] = truncateTokens(lines[i], budget-2)
+			tokens = EstimateTokens(lines[i]) + 2
+		}
+		picked = append(picked, i)
+		used += tokens
+	}
+	sort.Ints(picked)
+
+	var trimmed strings.Builder
+	starts := make([]int, 0, len(picked))
+	for n, i := range picked {
+		if n > 0 && picked[n-1] != i-1 {
+			trimmed.WriteString("[…]\n")
+		}
+		trimmed.WriteString(lines[i] + "\n")
+		starts = append(starts, int(windows[i].Start))
+	}
+	p.logger.Debug("Trimmed chat context", "videoID", video.ID, "windows", len(picked), "total", len(windows))
+	return trimmed.String(), starts
+}
+
+// truncateTokens cuts text to at most maxTokens estimated tokens, marking the cut
+func truncateTokens(text string, maxTokens int) string {
+	if EstimateTokens(text) <= maxTokens {
+		return text
+	}
+	const mark = " […]"
+	cut := maxTokens*4 - len(mark)
+	if cut <= 0 {
+		return ""
+	}
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(text[:cut]) + mark
+}
+
+// windowScores rates how relevant each transcript window is to the query,
+// by embeddings when semantic search has them and by shared words otherwise
+func (p *Processor) windowScores(ctx context.Context, videoID string, windows []Chunk, query string) []float64 {
+	scores := make([]float64, len(windows))
+	if p.semantic != nil {
+		byText, err := p.semantic.transcriptScores(ctx, videoID, query)
+		if err != nil {
+			p.logger.Warn("Failed to rank transcript by embeddings", "videoID", videoID, "error", err)
+		}
+		if len(byText) > 0 {
+			for i, window := range windows {
+				scores[i] = byText[window.Text]
+			}
+			return scores
+		}
+	}
+
+	// Words shared with the query, weighted by how rare they are in the video
+	terms := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if len(term) > 2 {
+			terms[term] = true
+		}
+	}
+	counts := make([]map[string]int, len(windows))
+	documents := make(map[string]int)
+	for i, window := range windows {
+		counts[i] = make(map[string]int)
+		for _, token := range tokenize(window.Text) {
+			if terms[token] {
+				if counts[i][token] == 0 {
+					documents[token]++
+				}
+				counts[i][token]++
+			}
+		}
+	}
+	for i := range windows {
+		for term, count := range counts[i] {
+			idf := math.Log(float64(len(windows)) / float64(documents[term]))
+			scores[i] += (1 + math.Log(float64(count))) * idf
+		}
+	}
+	return scores
+}
+
+var timestampPattern = regexp.MustCompile(`\[((?:(\d+):)?(\d{1,2}):(\d{2}))\]`)
+
+// LinkTimestamps turns timestamps cited in square brackets, like [12:30],
+// into Markdown links to that moment of the video
+func LinkTimestamps(videoID string, text string) string {
+	return timestampPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := timestampPattern.FindStringSubmatch(match)
+		hours, _ := strconv.Atoi(parts[2])
+		minutes, _ := strconv.Atoi(parts[3])
+		seconds, _ := strconv.Atoi(parts[4])
+		return fmt.Sprintf("[%s](/videos/%s?t=%d)", parts[1], videoID, hours*3600+minutes*60+seconds)
+	})
+}
+
+func chatPath(videoID string, chatID string, dataDir string) (string, error) {
+	return dataPath(dataDir, videoID, "chats", chatID+".json")
+}
+
+func SaveChat(chat Chat, dataDir string) error {
+	path, err := chatPath(chat.VideoID, chat.ID, dataDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	chatJSON, err := json.Marshal(chat)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, chatJSON, 0644)
+}
+
+func LoadChat(videoID string, chatID string, dataDir string) (*Chat, error) {
+	path, err := chatPath(videoID, chatID, dataDir)
+	if err != nil {
+		return nil, err
+	}
+	chatJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chat Chat
+	if err := json.Unmarshal(chatJSON, &chat); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// LoadChats loads a video's chats, most recently active first
+func LoadChats(videoID string, dataDir string) ([]Chat, error) {
+	dir, err := dataPath(dataDir, videoID, "chats")
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var chats []Chat
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		chat, err := LoadChat(videoID, strings.TrimSuffix(file.Name(), ".json"), dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chat %s: %v", file.Name(), err)
+		}
+		chats = append(chats, *chat)
+	}
+	sort.Slice(chats, func(i, j int) bool {
+		return chats[i].UpdatedAt.After(chats[j].UpdatedAt)
+	})
+	return chats, nil
+}
+
+func DeleteChat(videoID string, chatID string, dataDir string) error {
+	path, err := chatPath(videoID, chatID, dataDir)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+func TestChatContextStaysInBudget(t *testing.T) {
+	var segments []yt.Segment
+	for i := 0; i < 200; i++ {
+		segments = append(segments, yt.Segment{Start: float64(i * 10), Duration: 10, Text: fmt.Sprintf("Part %d is about topic%d and nothing else.", i, i%20)})
+	}
+	plain := strings.Repeat("A legacy transcript without timings mentions topic7 here. ", 400)
+	tests := []struct {
+		name      string
+		video     yt.Video
+		maxTokens int
+		trimmed   bool
+	}{
+		{"timed fits", yt.Video{Segments: segments[:4], Transcript: "x"}, 10000, false},
+		{"timed trimmed", yt.Video{Segments: segments}, 1000, true},
+		{"plain trimmed", yt.Video{Transcript: plain}, 1000, true},
+		// Budgets smaller than a single window still hold
+		{"timed tiny budget", yt.Video{Segments: segments}, 40, true},
+		{"plain tiny budget", yt.Video{Transcript: plain}, 40, true},
+	}
+	for _, tt := range tests {
+		p, _ := newTestProcessor(t)
+		p.SetChunking(tt.maxTokens, "")
+		text, starts := p.chatContext(context.Background(), tt.video, "what about topic7?")
+		budget := int(float64(tt.maxTokens) * chatContextShare)
+		if tokens := EstimateTokens(text); tokens > budget {
+			t.Errorf("%s: context is %d tokens, over the budget of %d", tt.name, tokens, budget)
+		}
+		if strings.TrimSpace(text) == "" {
+			t.Errorf("%s: context is empty", tt.name)
+		}
+		if tt.trimmed != (starts != nil) {
+			t.Errorf("%s: trimmed = %v, want %v", tt.name, starts != nil, tt.trimmed)
+		}
+		if tt.trimmed && !strings.Contains(text, "topic7") {
+			t.Errorf("%s: context misses the windows matching the question:\n%s", tt.name, text)
+		}
+		if len(tt.video.Segments) == 0 && strings.Contains(text, "[0:00]") {
+			t.Errorf("%s: transcript without timings got timestamps", tt.name)
+		}
+	}
+}
+
+func TestTruncateTokens(t *testing.T) {
+	tests := []struct {
+		text      string
+		maxTokens int
+	}{
+		{"short", 10},
+		{strings.Repeat("word ", 100), 10},
+		{strings.Repeat("é", 100), 5},
+		{strings.Repeat("a", 100), 1},
+	}
+	for _, tt := range tests {
+		got := truncateTokens(tt.text, tt.maxTokens)
+		if EstimateTokens(got) > tt.maxTokens {
+			t.Errorf("truncateTokens(%q, %d) = %q, over budget", tt.text, tt.maxTokens, got)
+		}
+		if !strings.HasPrefix(tt.text, strings.TrimSuffix(got, " […]")) {
+			t.Errorf("truncateTokens(%q, %d) = %q, not a prefix", tt.text, tt.maxTokens, got)
+		}
+	}
+}
+
+func TestChatJob(t *testing.T) {
+	p, dataDir := newTestProcessor(t)
+	p.SetBackend(&stubBackend{name: "stub", output: "It is about topic7 [0:10]."})
+	if err := p.Store().SaveVideo(yt.Video{ID: "aaaaaaaaaa1", Title: "Video", Transcript: "Talks about topic7."}); err != nil {
+		t.Fatal(err)
+	}
+	p.RegisterJobs(NewJobQueue(testLogger(), p.Store(), 1))
+
+	if _, err := p.EnqueueChat("aaaaaaaaaa1", "", "default", "   "); err == nil {
+		t.Error("empty question was queued")
+	}
+	job, err := p.EnqueueChat("aaaaaaaaaa1", "", "default", "What is it about?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Kind != JobChat || job.Params["question"] != "What is it about?" {
+		t.Errorf("queued %+v", job)
+	}
+
+	var streamed strings.Builder
+	result, err := p.runChatJob(context.Background(), job, func(chunk string) { streamed.WriteString(chunk) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed.String() != "It is about topic7 [0:10]." {
+		t.Errorf("streamed %q, want the answer", streamed.String())
+	}
+	chatID, ok := strings.CutPrefix(result, "/videos/aaaaaaaaaa1/chat?chat=")
+	if !ok {
+		t.Fatalf("result %q does not link to the chat", result)
+	}
+
+	// Follow-ups go to the same chat
+	job, err = p.EnqueueChat("aaaaaaaaaa1", chatID, "", "Why?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.runChatJob(context.Background(), job, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	chat, err := LoadChat("aaaaaaaaaa1", chatID, filepath.Join(dataDir, "videos"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chat.Messages) != 4 || chat.Messages[2].Content != "Why?" {
+		t.Errorf("chat has %d messages, want both questions and answers", len(chat.Messages))
+	}
+}
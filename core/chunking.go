@@ -0,0 +1,131 @@
+package core
+
+import (
+	"fabric-agents/yt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var sentenceEndRegex = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+
+// Chunk is a contiguous piece of a transcript. Start and End are in seconds
+// and are only set when the transcript has timed segments.
+type Chunk struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// EstimateTokens roughly estimates the number of model tokens in text, using
+// the common rule of thumb of four characters per token
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// ChunkTranscript splits a video's transcript into chunks of at most
+// maxTokens estimated tokens. Timed transcripts are split on segment
+// boundaries, plain ones on sentence boundaries.
+func ChunkTranscript(video yt.Video, maxTokens int) []Chunk {
+	if len(video.Segments) > 0 {
+		return chunkSegments(video.Segments, maxTokens)
+	}
+	return ChunkText(video.Transcript, maxTokens)
+}
+
+func chunkSegments(segments []yt.Segment, maxTokens int) []Chunk {
+	var chunks []Chunk
+	var current Chunk
+	var texts []string
+	tokens := 0
+	for _, segment := range segments {
+		segmentTokens := EstimateTokens(segment.Text) + 1
+		if len(texts) > 0 && tokens+segmentTokens > maxTokens {
+			current.Text = strings.Join(texts, " ")
+			chunks = append(chunks, current)
+			texts, tokens = nil, 0
+		}
+		if len(texts) == 0 {
+			current = Chunk{Start: segment.Start}
+		}
+		texts = append(texts, segment.Text)
+		current.End = segment.Start + segment.Duration
+		tokens += segmentTokens
+	}
+	if len(texts) > 0 {
+		current.Text = strings.Join(texts, " ")
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// ChunkText splits plain text into chunks of at most maxTokens estimated
+// tokens, breaking between sentences. A sentence longer than a whole chunk is
+// broken between words, and a word longer than a whole chunk is cut up.
+func ChunkText(text string, maxTokens int) []Chunk {
+	var chunks []Chunk
+	var current strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, Chunk{Text: s})
+		}
+		current.Reset()
+	}
+
+	for _, sentence := range splitSentences(text) {
+		if EstimateTokens(sentence) > maxTokens {
+			flush()
+			for _, word := range strings.Fields(sentence) {
+				for _, piece := range splitWord(word, maxTokens*4) {
+					if current.Len() > 0 && EstimateTokens(current.String())+EstimateTokens(piece)+1 > maxTokens {
+						flush()
+					}
+					current.WriteString(piece + " ")
+				}
+			}
+			continue
+		}
+		if current.Len() > 0 && EstimateTokens(current.String())+EstimateTokens(sentence) > maxTokens {
+			flush()
+		}
+		current.WriteString(sentence)
+	}
+	flush()
+	return chunks
+}
+
+// splitWord cuts a word into pieces of at most maxChars bytes without
+// splitting a character
+func splitWord(word string, maxChars int) []string {
+	if maxChars <= 0 || len(word) <= maxChars {
+		return []string{word}
+	}
+	var pieces []string
+	for len(word) > maxChars {
+		cut := maxChars
+		for cut > 0 && !utf8.RuneStart(word[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = maxChars
+		}
+		pieces = append(pieces, word[:cut])
+		word = word[cut:]
+	}
+	return append(pieces, word)
+}
+
+// splitSentences splits text after sentence-ending punctuation, keeping the
+// punctuation and trailing whitespace with each sentence
+func splitSentences(text string) []string {
+	var sentences []string
+	last := 0
+	for _, loc := range sentenceEndRegex.FindAllStringIndex(text, -1) {
+		sentences = append(sentences, text[last:loc[1]])
+		last = loc[1]
+	}
+	if last < len(text) {
+		sentences = append(sentences, text[last:])
+	}
+	return sentences
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"fabric-agents/yt"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"four", 1},
+		{"five!", 2},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		want      []string
+	}{
+		{"fits", "One. Two.", 10, []string{"One. Two."}},
+		{"between sentences", "First sentence here. Second one here. Third.", 6, []string{"First sentence here.", "Second one here.", "Third."}},
+		{"long sentence between words", "one two three four five six", 4, []string{"one two", "three four", "five six"}},
+		{"long word cut up", "abcdefghijkl", 1, []string{"abcd", "efgh", "ijkl"}},
+		{"empty", "  ", 10, nil},
+	}
+	for _, tt := range tests {
+		chunks := ChunkText(tt.text, tt.maxTokens)
+		var got []string
+		for _, chunk := range chunks {
+			got = append(got, chunk.Text)
+			if EstimateTokens(chunk.Text) > tt.maxTokens {
+				t.Errorf("%s: chunk %q is over %d tokens", tt.name, chunk.Text, tt.maxTokens)
+			}
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: chunks = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWordKeepsCharacters(t *testing.T) {
+	word := strings.Repeat("ü", 10)
+	pieces := splitWord(word, 3)
+	if strings.Join(pieces, "") != word {
+		t.Fatalf("pieces %q don't reassemble %q", pieces, word)
+	}
+	for _, piece := range pieces {
+		if !utf8.ValidString(piece) || len(piece) > 3 {
+			t.Errorf("piece %q splits a character or is over 3 bytes", piece)
+		}
+	}
+}
+
+func TestChunkTranscriptBySegments(t *testing.T) {
+	video := yt.Video{Segments: []yt.Segment{
+		{Start: 0, Duration: 2, Text: "first segment"},
+		{Start: 2, Duration: 3, Text: "second segment"},
+		{Start: 5, Duration: 1, Text: "third"},
+	}}
+	chunks := ChunkTranscript(video, 8)
+	want := []Chunk{
+		{Start: 0, End: 2, Text: "first segment"},
+		{Start: 2, End: 6, Text: "second segment third"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("chunks = %+v, want %+v", chunks, want)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("chunk %d = %+v, want %+v", i, chunks[i], want[i])
+		}
+	}
+
+	// Without segments the transcript is split as plain text
+	plain := ChunkTranscript(yt.Video{Transcript: "One. Two."}, 10)
+	if len(plain) != 1 || plain[0].Text != "One. Two." || plain[0].End != 0 {
+		t.Errorf("plain chunks = %+v", plain)
+	}
+}
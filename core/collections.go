@@ -0,0 +1,90 @@
+package core
+
+import (
+	"encoding/json"
+	"fabric-agents/yt"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Collection is a named group of videos, such as an expanded playlist
+type Collection struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Kind      string    `json:"kind"`
+	Source    string    `json:"source"`
+	URL       string    `json:"url"`
+	VideoIDs  []string  `json:"video_ids"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PlaylistSource is implemented by sources whose links can refer to a list of videos
+type PlaylistSource interface {
+	Source
+	// GetPlaylistID returns the playlist ID carried by a link, or "" if there is none
+	GetPlaylistID(link string) string
+	// GetPlaylist fetches the playlist a link refers to
+	GetPlaylist(link string) (*yt.Playlist, error)
+}
+
+func SaveCollection(collection Collection, dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	path, err := dataPath(dataDir, collection.ID+".json")
+	if err != nil {
+		return err
+	}
+	collectionJSON, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, collectionJSON, 0644)
+}
+
+func LoadCollection(collectionID string, dataDir string) (*Collection, error) {
+	path, err := dataPath(dataDir, collectionID+".json")
+	if err != nil {
+		return nil, err
+	}
+	collectionJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var collection Collection
+	if err := json.Unmarshal(collectionJSON, &collection); err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// LoadCollections loads all collections, most recently updated first
+func LoadCollections(dataDir string) ([]Collection, error) {
+	files, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var collections []Collection
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		collection, err := LoadCollection(strings.TrimSuffix(file.Name(), ".json"), dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load collection %s: %v", file.Name(), err)
+		}
+		collections = append(collections, *collection)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].UpdatedAt.After(collections[j].UpdatedAt)
+	})
+	return collections, nil
+}
@@ -9,67 +9,119 @@ import (
 	"strings"
 )
 
-// LoadVideos loads all videos from the data directory
-func LoadVideos(dataDir string) ([]yt.Video, error) {
+// CorruptVideo is a video whose data could not be read. Listings skip it
+// and report it instead of failing.
+type CorruptVideo struct {
+	ID    string
+	Error string
+}
+
+// LoadVideos loads all videos from the data directory, skipping those whose
+// data.json can't be read
+func LoadVideos(dataDir string) ([]yt.Video, []CorruptVideo, error) {
 	files, err := os.ReadDir(dataDir)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var videos []yt.Video
+	var corrupt []CorruptVideo
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() && ValidFileName(file.Name()) {
 			video, err := LoadVideo(file.Name(), dataDir)
 			if err != nil {
-				return nil, err
+				corrupt = append(corrupt, CorruptVideo{ID: file.Name(), Error: err.Error()})
+				continue
 			}
 			if video != nil {
 				videos = append(videos, *video)
 			}
 		}
 	}
-	return videos, nil
+	return videos, corrupt, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it and
+// renames it over path, so a crash leaves either the old file or the new one
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Sync the directory too so the rename itself survives a crash
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
 func SaveVideo(video yt.Video, dataDir string) error {
-	videoDir := filepath.Join(dataDir, video.ID)
-	os.MkdirAll(videoDir, 0755)
+	videoDir, err := dataPath(dataDir, video.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(videoDir, 0755); err != nil {
+		return err
+	}
 	transcriptPath := filepath.Join(videoDir, "data.json")
 	videoJSON, err := json.Marshal(video)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(transcriptPath, videoJSON, 0644)
-}
-
-func SaveVideoFabricOutput(videoID string, output string, summary string, model string, dataDir string) error {
-	videoDir := filepath.Join(dataDir, videoID)
-	os.MkdirAll(videoDir, 0755)
-	outputPath := filepath.Join(videoDir, fmt.Sprintf("%s-%s.md", summary, model))
-	return os.WriteFile(outputPath, []byte(output), 0644)
+	return writeFileAtomic(transcriptPath, videoJSON, 0644)
 }
 
+// LoadVideo returns nil without an error when the video has no data.json
 func LoadVideo(videoID string, dataDir string) (*yt.Video, error) {
-	videoDir := filepath.Join(dataDir, videoID)
+	videoDir, err := dataPath(dataDir, videoID)
+	if err != nil {
+		return nil, err
+	}
 	transcriptPath := filepath.Join(videoDir, "data.json")
 	videoJSON, err := os.ReadFile(transcriptPath)
-	if err != nil {
+	if os.IsNotExist(err) {
 		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	var video yt.Video
 	err = json.Unmarshal(videoJSON, &video)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("corrupt data.json: %v", err)
 	}
 
 	return &video, nil
 }
 
 func LoadVideoSummary(videoID string, dataDir string, summaryFileName string) (string, error) {
-	videoDir := filepath.Join(dataDir, videoID)
-	summaryPath := filepath.Join(videoDir, summaryFileName)
+	summaryPath, err := dataPath(dataDir, videoID, summaryFileName)
+	if err != nil {
+		return "", err
+	}
 	summary, err := os.ReadFile(summaryPath)
 	if err != nil {
 		return "", err
@@ -78,7 +130,10 @@ func LoadVideoSummary(videoID string, dataDir string, summaryFileName string) (s
 }
 
 func LoadVideoFiles(videoID string, dataDir string) ([]string, error) {
-	videoDir := filepath.Join(dataDir, videoID)
+	videoDir, err := dataPath(dataDir, videoID)
+	if err != nil {
+		return nil, err
+	}
 	files, err := os.ReadDir(videoDir)
 	if err != nil {
 		return nil, err
@@ -94,7 +149,10 @@ func LoadVideoFiles(videoID string, dataDir string) ([]string, error) {
 }
 
 func DeleteVideo(videoID string, dataDir string) error {
-	videoDir := filepath.Join(dataDir, videoID)
+	videoDir, err := dataPath(dataDir, videoID)
+	if err != nil {
+		return err
+	}
 	return os.RemoveAll(videoDir)
 }
 
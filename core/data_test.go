@@ -0,0 +1,106 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+// tempFiles lists the temporary files writeFileAtomic left in dir
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Errorf("read %q, %v; want %q", data, err, content)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	if leftover := tempFiles(t, dir); len(leftover) != 0 {
+		t.Errorf("temporary files left behind: %v", leftover)
+	}
+}
+
+func TestWriteFileAtomicFailureKeepsOldFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// The temporary file's name is longer than the target's, so a name at
+	// the length limit can't get one and the write fails before the rename
+	path := filepath.Join(dir, strings.Repeat("a", 250)+".json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("new"), 0644); err == nil {
+		t.Fatal("write with an over-long temporary name succeeded")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "old" {
+		t.Errorf("after a failed write read %q, %v; want the old content", data, err)
+	}
+
+	// A rename that fails removes the temporary file
+	target := filepath.Join(dir, "target")
+	if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(target, []byte("new"), 0644); err == nil {
+		t.Fatal("write over a non-empty directory succeeded")
+	}
+	if leftover := tempFiles(t, dir); len(leftover) != 0 {
+		t.Errorf("temporary files left behind: %v", leftover)
+	}
+}
+
+func TestLoadVideosReportsCorrupt(t *testing.T) {
+	dataDir := t.TempDir()
+	for _, id := range []string{"aaaaaaaaaa1", "cccccccccc3"} {
+		if err := SaveVideo(yt.Video{ID: id, Title: "Title of " + id}, dataDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A data.json cut short by a crash
+	if err := os.MkdirAll(filepath.Join(dataDir, "bbbbbbbbbb2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "bbbbbbbbbb2", "data.json"), []byte(`{"ID": "bbbbbbbbbb2", "Tit`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Neither a directory without data.json nor a hidden one is a video
+	for _, dir := range []string{"dddddddddd4", ".hidden"} {
+		if err := os.MkdirAll(filepath.Join(dataDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	videos, corrupt, err := LoadVideos(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 2 || videos[0].ID != "aaaaaaaaaa1" || videos[1].ID != "cccccccccc3" {
+		t.Errorf("loaded %+v, want the two readable videos", videos)
+	}
+	if len(corrupt) != 1 || corrupt[0].ID != "bbbbbbbbbb2" || !strings.Contains(corrupt[0].Error, "corrupt data.json") {
+		t.Errorf("corrupt = %+v, want the truncated video", corrupt)
+	}
+
+	if video, err := LoadVideo("dddddddddd4", dataDir); video != nil || err != nil {
+		t.Errorf("LoadVideo of a directory without data.json = %v, %v; want nil, nil", video, err)
+	}
+}
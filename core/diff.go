@@ -0,0 +1,111 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+type DiffKind string
+
+const (
+	DiffEqual  DiffKind = "equal"
+	DiffInsert DiffKind = "insert"
+	DiffDelete DiffKind = "delete"
+)
+
+// DiffOp is a run of text that is shared by both sides of a diff, or only
+// present in one of them
+type DiffOp struct {
+	Kind DiffKind
+	Text string
+}
+
+// maxDiffCells bounds the size of the comparison table. Inputs too large to
+// compare word by word are compared line by line instead, and those too
+// large for that are not diffed at all.
+const maxDiffCells = 4 << 20
+
+var diffTokenRegex = regexp.MustCompile(`\s+|[^\s]+`)
+
+// DiffWords returns the word-level differences that turn a into b. Runs of
+// whitespace count as tokens of their own so the ops reassemble both texts
+// exactly. It reports false when the texts are too large to diff.
+func DiffWords(a, b string) ([]DiffOp, bool) {
+	aTokens := diffTokenRegex.FindAllString(a, -1)
+	bTokens := diffTokenRegex.FindAllString(b, -1)
+	if len(aTokens)*len(bTokens) > maxDiffCells {
+		aTokens = strings.SplitAfter(a, "\n")
+		bTokens = strings.SplitAfter(b, "\n")
+		if len(aTokens)*len(bTokens) > maxDiffCells {
+			return nil, false
+		}
+	}
+	return diffTokens(aTokens, bTokens), true
+}
+
+// diffTokens diffs two token lists through their longest common subsequence
+func diffTokens(a, b []string) []DiffOp {
+	// Common prefixes and suffixes are cheap to split off and often most of the text
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	add := func(kind DiffKind, text string) {
+		if text == "" {
+			return
+		}
+		if len(ops) > 0 && ops[len(ops)-1].Kind == kind {
+			ops[len(ops)-1].Text += text
+			return
+		}
+		ops = append(ops, DiffOp{Kind: kind, Text: text})
+	}
+
+	add(DiffEqual, strings.Join(a[:prefix], ""))
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of midA[i:] and midB[j:]
+	lcs := make([][]int32, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			switch {
+			case midA[i] == midB[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(midA) && j < len(midB) {
+		switch {
+		case midA[i] == midB[j]:
+			add(DiffEqual, midA[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(DiffDelete, midA[i])
+			i++
+		default:
+			add(DiffInsert, midB[j])
+			j++
+		}
+	}
+	add(DiffDelete, strings.Join(midA[i:], ""))
+	add(DiffInsert, strings.Join(midB[j:], ""))
+
+	add(DiffEqual, strings.Join(a[len(a)-suffix:], ""))
+	return ops
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// diffSides reassembles both texts from a diff
+func diffSides(ops []DiffOp) (string, string) {
+	var a, b strings.Builder
+	for _, op := range ops {
+		if op.Kind != DiffInsert {
+			a.WriteString(op.Text)
+		}
+		if op.Kind != DiffDelete {
+			b.WriteString(op.Text)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []DiffOp
+	}{
+		{"same text", "same text", []DiffOp{{DiffEqual, "same text"}}},
+		{"", "", nil},
+		{"", "new", []DiffOp{{DiffInsert, "new"}}},
+		{"the quick fox", "the quick brown fox", []DiffOp{{DiffEqual, "the quick "}, {DiffInsert, "brown "}, {DiffEqual, "fox"}}},
+		{"the quick brown fox", "the fox", []DiffOp{{DiffEqual, "the "}, {DiffDelete, "quick brown "}, {DiffEqual, "fox"}}},
+		{"a red car", "a blue car", []DiffOp{{DiffEqual, "a "}, {DiffDelete, "red"}, {DiffInsert, "blue"}, {DiffEqual, " car"}}},
+		{"one\ntwo", "one two", []DiffOp{{DiffEqual, "one"}, {DiffDelete, "\n"}, {DiffInsert, " "}, {DiffEqual, "two"}}},
+	}
+	for _, tt := range tests {
+		ops, ok := DiffWords(tt.a, tt.b)
+		if !ok {
+			t.Errorf("DiffWords(%q, %q) reported too large", tt.a, tt.b)
+			continue
+		}
+		if !reflect.DeepEqual(ops, tt.want) {
+			t.Errorf("DiffWords(%q, %q) = %v, want %v", tt.a, tt.b, ops, tt.want)
+		}
+	}
+}
+
+func TestDiffWordsFallsBackToLines(t *testing.T) {
+	// 30 lines of 100 words are too many words to compare but few lines
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, strings.TrimSpace(strings.Repeat(fmt.Sprintf("w%d ", i), 100)))
+	}
+	a := strings.Join(lines, "\n")
+	original := lines[10] + "\n"
+	lines[10] = strings.Replace(lines[10], "w10", "changed", 1)
+	b := strings.Join(lines, "\n")
+
+	ops, ok := DiffWords(a, b)
+	if !ok {
+		t.Fatal("line diff reported too large")
+	}
+	if gotA, gotB := diffSides(ops); gotA != a || gotB != b {
+		t.Error("diff does not reassemble both texts")
+	}
+	var changed []DiffOp
+	for _, op := range ops {
+		if op.Kind != DiffEqual {
+			changed = append(changed, op)
+		}
+	}
+	want := []DiffOp{{DiffDelete, original}, {DiffInsert, lines[10] + "\n"}}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changes = %q, want the whole changed line", changed)
+	}
+}
+
+func TestDiffWordsTooLarge(t *testing.T) {
+	// Too many lines to compare even line by line
+	a := strings.Repeat("word\n", 2100)
+	b := strings.Repeat("other\n", 2100)
+	if ops, ok := DiffWords(a, b); ok || ops != nil {
+		t.Errorf("DiffWords of %d lines = %d ops, %v; want too large", 2100, len(ops), ok)
+	}
+}
@@ -0,0 +1,509 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fabric-agents/yt"
+)
+
+// embedBatchSize is how many texts are sent in one embeddings request
+const embedBatchSize = 32
+
+// embedRequestTimeout bounds a single embeddings request, and
+// embedUpdateTimeout a whole background update, so a stalled endpoint can't
+// hold up later updates
+const (
+	embedRequestTimeout = time.Minute
+	embedUpdateTimeout  = 5 * time.Minute
+)
+
+// maxEmbedChars is the longest a transcript window or output passage may get
+// before it is split, keeping passages well inside small embedding models'
+// context
+const maxEmbedChars = 1500
+
+// Embedder computes embeddings through an OpenAI-compatible /v1/embeddings
+// endpoint such as Ollama's
+type Embedder struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewEmbedder creates an embedder for the API at baseURL (with or without the /v1 suffix)
+func NewEmbedder(baseURL, apiKey, model string) *Embedder {
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	return &Embedder{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: embedRequestTimeout},
+	}
+}
+
+// Model returns the name of the embedding model
+func (e *Embedder) Model() string {
+	return e.model
+}
+
+// Embed returns one vector per text, in order
+func (e *Embedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/v1/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting embeddings: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error requesting embeddings: server returned %s", resp.Status)
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error parsing embeddings: %v", err)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings endpoint returned %d vectors for %d texts", len(response.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range response.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings endpoint returned an out of range index %d", item.Index)
+		}
+		vectors[item.Index] = normalize(item.Embedding)
+	}
+	return vectors, nil
+}
+
+// normalize scales a vector to unit length so cosine similarity is a dot product
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+// EmbeddedPassage is one embedded piece of a transcript or output
+type EmbeddedPassage struct {
+	Kind  string  `json:"kind"`
+	Label string  `json:"label,omitempty"`
+	Link  string  `json:"link"`
+	Start float64 `json:"start,omitempty"`
+	Text  string  `json:"text"`
+	// Hash identifies the text so unchanged passages keep their vector
+	Hash   string    `json:"hash"`
+	Vector []float32 `json:"vector"`
+}
+
+// embeddingSet holds the passages of one video or synthesis. Sets are stored
+// under the embeddings directory as videos/<id>.json and syntheses/<id>.json.
+type embeddingSet struct {
+	Model    string            `json:"model"`
+	VideoID  string            `json:"video_id,omitempty"`
+	Title    string            `json:"title"`
+	Passages []EmbeddedPassage `json:"passages"`
+}
+
+// SemanticIndex finds the transcript and output passages closest in meaning
+// to a query. Vectors are kept on disk and in memory; updates run in the
+// background and only embed passages whose text changed.
+type SemanticIndex struct {
+	logger   *slog.Logger
+	embedder *Embedder
+	dir      string
+
+	mu   sync.RWMutex
+	sets map[string]*embeddingSet
+	// pending holds the latest queued change of each owner, so an owner
+	// changed twice in a row is only embedded once, with its newest text
+	pending map[string]*embeddingSet
+
+	// updateMu serializes updates so the endpoint sees one batch at a time
+	updateMu sync.Mutex
+}
+
+func NewSemanticIndex(logger *slog.Logger, embedder *Embedder, dir string) *SemanticIndex {
+	return &SemanticIndex{
+		logger:   logger,
+		embedder: embedder,
+		dir:      dir,
+		sets:     make(map[string]*embeddingSet),
+		pending:  make(map[string]*embeddingSet),
+	}
+}
+
+func (s *SemanticIndex) setPath(owner string) string {
+	return filepath.Join(s.dir, owner+".json")
+}
+
+// Load reads the stored embeddings made with the current model
+func (s *SemanticIndex) Load() error {
+	for _, kind := range []string{"videos", "syntheses"} {
+		entries, err := os.ReadDir(filepath.Join(s.dir, kind))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+				continue
+			}
+			owner := kind + "/" + strings.TrimSuffix(entry.Name(), ".json")
+			setJSON, err := os.ReadFile(s.setPath(owner))
+			if err != nil {
+				return err
+			}
+			var set embeddingSet
+			if err := json.Unmarshal(setJSON, &set); err != nil {
+				s.logger.Warn("Skipping unreadable embeddings", "owner", owner, "error", err)
+				continue
+			}
+			if set.Model != s.embedder.Model() {
+				continue
+			}
+			s.mu.Lock()
+			s.sets[owner] = &set
+			s.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// update queues the embedding of an owner's passages. A nil set removes the
+// owner's embeddings.
+func (s *SemanticIndex) update(owner string, set *embeddingSet) {
+	s.mu.Lock()
+	s.pending[owner] = set
+	s.mu.Unlock()
+	go func() {
+		s.updateMu.Lock()
+		defer s.updateMu.Unlock()
+		s.mu.Lock()
+		set, ok := s.pending[owner]
+		delete(s.pending, owner)
+		s.mu.Unlock()
+		if !ok {
+			// A later update already handled the owner
+			return
+		}
+		var err error
+		if set == nil {
+			err = s.remove(owner)
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), embedUpdateTimeout)
+			err = s.embed(ctx, owner, set)
+			cancel()
+		}
+		if err != nil {
+			s.logger.Warn("Failed to update embeddings", "owner", owner, "error", err)
+		}
+	}()
+}
+
+// embed computes the vectors of a set's passages, reusing those of passages
+// that did not change, and saves it
+func (s *SemanticIndex) embed(ctx context.Context, owner string, set *embeddingSet) error {
+	known := make(map[string][]float32)
+	s.mu.RLock()
+	current := s.sets[owner]
+	if current != nil {
+		for _, passage := range current.Passages {
+			known[passage.Hash] = passage.Vector
+		}
+	}
+	s.mu.RUnlock()
+
+	passages := set.Passages
+	var missing []int
+	for i := range passages {
+		hash := sha256.Sum256([]byte(passages[i].Text))
+		passages[i].Hash = hex.EncodeToString(hash[:])
+		if vector, ok := known[passages[i].Hash]; ok {
+			passages[i].Vector = vector
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	for start := 0; start < len(missing); start += embedBatchSize {
+		batch := missing[start:min(start+embedBatchSize, len(missing))]
+		texts := make([]string, len(batch))
+		for j, i := range batch {
+			texts[j] = passages[i].Text
+		}
+		vectors, err := s.embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for j, i := range batch {
+			passages[i].Vector = vectors[j]
+		}
+	}
+
+	if len(missing) == 0 && current != nil && samePassages(current, set) {
+		return nil
+	}
+
+	set.Model = s.embedder.Model()
+	setJSON, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.setPath(owner)), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.setPath(owner), setJSON, 0644); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.sets[owner] = set
+	s.mu.Unlock()
+	if len(missing) > 0 {
+		s.logger.Info("Embeddings updated", "owner", owner, "embedded", len(missing), "passages", len(passages))
+	}
+	return nil
+}
+
+// samePassages reports whether two sets hold the same texts in the same order
+func samePassages(a *embeddingSet, b *embeddingSet) bool {
+	if a.Title != b.Title || len(a.Passages) != len(b.Passages) {
+		return false
+	}
+	for i := range a.Passages {
+		if a.Passages[i].Hash != b.Passages[i].Hash || a.Passages[i].Link != b.Passages[i].Link || a.Passages[i].Label != b.Passages[i].Label {
+			return false
+		}
+	}
+	return true
+}
+
+// remove drops an owner's embeddings
+func (s *SemanticIndex) remove(owner string) error {
+	s.mu.Lock()
+	delete(s.sets, owner)
+	s.mu.Unlock()
+	if err := os.Remove(s.setPath(owner)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Search returns the passages closest to the query, best first. Scores are
+// cosine similarities.
+func (s *SemanticIndex) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	target := vectors[0]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var hits []SearchHit
+	for _, set := range s.sets {
+		for _, passage := range set.Passages {
+			if len(passage.Vector) != len(target) {
+				continue
+			}
+			var score float64
+			for i, v := range passage.Vector {
+				score += float64(v) * float64(target[i])
+			}
+			hits = append(hits, SearchHit{
+				Kind:    passage.Kind,
+				VideoID: set.VideoID,
+				Title:   set.Title,
+				Label:   passage.Label,
+				Link:    passage.Link,
+				Start:   passage.Start,
+				Snippet: snippet(passage.Text, nil),
+				Score:   score,
+			})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// transcriptScores returns how close each embedded transcript window of a
+// video is to the query, keyed by the window's text since windows of
+// transcripts without timings all start at 0. It returns nil when the video
+// has no embeddings yet.
+func (s *SemanticIndex) transcriptScores(ctx context.Context, videoID string, query string) (map[string]float64, error) {
+	s.mu.RLock()
+	set := s.sets["videos/"+videoID]
+	s.mu.RUnlock()
+	if set == nil {
+		return nil, nil
+	}
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[string]float64)
+	for _, passage := range set.Passages {
+		if passage.Kind != SearchTranscript || len(passage.Vector) != len(vectors[0]) {
+			continue
+		}
+		var score float64
+		for i, v := range passage.Vector {
+			score += float64(v) * float64(vectors[0][i])
+		}
+		scores[passage.Text] = score
+	}
+	return scores, nil
+}
+
+// splitPassages splits an output into passages of whole paragraphs of at
+// most maxEmbedChars. Longer paragraphs are split between sentences.
+func splitPassages(text string) []string {
+	var passages []string
+	var current strings.Builder
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if len(paragraph) > maxEmbedChars {
+			if current.Len() > 0 {
+				passages = append(passages, current.String())
+				current.Reset()
+			}
+			for _, piece := range ChunkText(paragraph, maxEmbedChars/4) {
+				passages = append(passages, piece.Text)
+			}
+			continue
+		}
+		if current.Len() > 0 && current.Len()+len(paragraph) > maxEmbedChars {
+			passages = append(passages, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(paragraph)
+	}
+	if current.Len() > 0 {
+		passages = append(passages, current.String())
+	}
+	return passages
+}
+
+// SetEmbedder enables semantic search with embeddings from the embedder,
+// stored under the data directory's embeddings directory
+func (p *Processor) SetEmbedder(embedder *Embedder) {
+	p.semantic = NewSemanticIndex(p.logger, embedder, p.embeddingsDir)
+}
+
+// SemanticSearchEnabled reports whether an embeddings endpoint is configured
+func (p *Processor) SemanticSearchEnabled() bool {
+	return p.semantic != nil
+}
+
+// SemanticSearch returns the transcript and output passages closest in
+// meaning to the query
+func (p *Processor) SemanticSearch(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	if p.semantic == nil {
+		return nil, fmt.Errorf("semantic search is not configured")
+	}
+	return p.semantic.Search(ctx, query, limit)
+}
+
+// embedVideo queues the embedding of a video's transcript windows and outputs
+func (p *Processor) embedVideo(video yt.Video, outputs []IndexedOutput) {
+	if p.semantic == nil {
+		return
+	}
+	var passages []EmbeddedPassage
+	for _, window := range transcriptWindows(video) {
+		passages = append(passages, EmbeddedPassage{
+			Kind:  SearchTranscript,
+			Link:  fmt.Sprintf("/videos/%s?t=%d", video.ID, int(window.Start)),
+			Start: window.Start,
+			Text:  window.Text,
+		})
+	}
+	for _, output := range outputs {
+		for _, text := range splitPassages(output.Text) {
+			passages = append(passages, EmbeddedPassage{
+				Kind:  SearchOutput,
+				Label: output.Label,
+				Link:  output.Link,
+				Text:  text,
+			})
+		}
+	}
+	p.semantic.update("videos/"+video.ID, &embeddingSet{VideoID: video.ID, Title: video.Title, Passages: passages})
+}
+
+// unembedVideo queues the removal of a deleted video's embeddings
+func (p *Processor) unembedVideo(videoID string) {
+	if p.semantic != nil {
+		p.semantic.update("videos/"+videoID, nil)
+	}
+}
+
+// embedSynthesis queues the embedding of a synthesis output
+func (p *Processor) embedSynthesis(synthesis Synthesis, output string) {
+	if p.semantic == nil {
+		return
+	}
+	var passages []EmbeddedPassage
+	for _, text := range splitPassages(output) {
+		passages = append(passages, EmbeddedPassage{
+			Kind:  SearchSynthesis,
+			Label: synthesis.Pattern + " · " + synthesis.Model,
+			Link:  "/syntheses/" + synthesis.ID,
+			Text:  text,
+		})
+	}
+	p.semantic.update("syntheses/"+synthesis.ID, &embeddingSet{Title: synthesis.Title, Passages: passages})
+}
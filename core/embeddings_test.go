@@ -0,0 +1,71 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestEmbedder serves embeddings that stall for inputs containing
+// "stall", signalling stalled when such a request arrives
+func newTestEmbedder(t *testing.T) (embedder *Embedder, stalled <-chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	stalls := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		type item struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var data []item
+		for i, input := range request.Input {
+			if strings.Contains(input, "stall") {
+				stalls <- struct{}{}
+				<-release
+				return
+			}
+			data = append(data, item{Index: i, Embedding: []float32{1, float32(len(input))}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(func() {
+		close(release)
+		server.Close()
+	})
+	return NewEmbedder(server.URL, "", "test"), stalls
+}
+
+func TestStalledEmbeddingsDoNotBlockUpdates(t *testing.T) {
+	embedder, stalled := newTestEmbedder(t)
+	embedder.client.Timeout = 100 * time.Millisecond
+	index := NewSemanticIndex(testLogger(), embedder, t.TempDir())
+
+	index.update("videos/stalled", &embeddingSet{VideoID: "stalled", Passages: []EmbeddedPassage{{Kind: SearchTranscript, Text: "stall"}}})
+	<-stalled
+	index.update("videos/fine", &embeddingSet{VideoID: "fine", Passages: []EmbeddedPassage{{Kind: SearchTranscript, Text: "fine"}}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		index.mu.RLock()
+		fine, stalled := index.sets["videos/fine"], index.sets["videos/stalled"]
+		index.mu.RUnlock()
+		if fine != nil {
+			if stalled != nil {
+				t.Error("stalled update was saved")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("update stayed blocked behind a stalled embeddings request")
+}
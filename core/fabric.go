@@ -1,27 +1,107 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// fabricWaitDelay bounds how long a killed fabric run may keep its output pipe open
+const fabricWaitDelay = 5 * time.Second
+
 // RunFabric runs the fabric command with the given pattern and model
 func RunFabric(input, pattern, model string) (string, error) {
-	var cmd *exec.Cmd
+	return RunFabricStream(context.Background(), input, pattern, model, nil)
+}
+
+// RunFabricStream runs fabric in streaming mode, calling onChunk with each
+// piece of output as soon as it is read. The full output is returned once
+// fabric exits. A nil onChunk behaves like RunFabric. An empty pattern sends
+// the input as a plain prompt. Cancelling ctx kills fabric along with any
+// processes it started.
+func RunFabricStream(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
 	fmt.Println("Running fabric with pattern:", pattern, "and model:", model)
+	var args []string
+	if pattern != "" {
+		args = append(args, "--pattern", pattern)
+	}
 	if model != "" && model != "default" {
-		cmd = exec.Command("fabric", "--pattern", pattern, "--model", model)
-	} else {
-		cmd = exec.Command("fabric", "--pattern", pattern)
+		args = append(args, "--model", model)
 	}
+	if onChunk != nil {
+		args = append(args, "--stream")
+	}
+	cmd := exec.CommandContext(ctx, "fabric", args...)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = fabricWaitDelay
 	cmd.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
 
-	output, err := cmd.Output()
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return "", fmt.Errorf("error executing fabric pattern: %v", err)
 	}
-	return string(output), nil
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("error executing fabric pattern: %v", err)
+	}
+
+	var output strings.Builder
+	var pending []byte
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := stdout.Read(buf)
+		if n > 0 {
+			// Hold back a multi-byte character split across reads until the rest of it arrives
+			var chunk []byte
+			chunk, pending = splitIncompleteRune(append(pending, buf[:n]...))
+			output.Write(chunk)
+			if onChunk != nil && len(chunk) > 0 {
+				onChunk(string(chunk))
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	output.Write(pending)
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("fabric run stopped: %v", ctx.Err())
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("error executing fabric pattern: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("error executing fabric pattern: %v", err)
+	}
+	return output.String(), nil
+}
+
+// splitIncompleteRune splits off a trailing partial UTF-8 sequence
+func splitIncompleteRune(data []byte) ([]byte, []byte) {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i], append([]byte(nil), data[i:]...)
+			}
+			break
+		}
+	}
+	return data, nil
+}
+
+// FabricVersion returns the version reported by the fabric binary
+func FabricVersion(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, "fabric", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("error getting fabric version: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
 }
 
 func ListPatterns() ([]string, error) {
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package core
+
+import "os/exec"
+
+// killProcessGroup is a no-op where process groups are unavailable; cancellation kills fabric itself
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RESTBackend talks to a fabric instance started with `fabric --serve`
+type RESTBackend struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewRESTBackend(baseURL string) *RESTBackend {
+	return &RESTBackend{baseURL: strings.TrimSuffix(baseURL, "/"), client: &http.Client{}}
+}
+
+func (b *RESTBackend) Name() string {
+	return "fabric-rest"
+}
+
+type restChatRequest struct {
+	Prompts  []restPrompt `json:"prompts"`
+	Language string       `json:"language,omitempty"`
+}
+
+type restPrompt struct {
+	UserInput   string `json:"userInput"`
+	Vendor      string `json:"vendor"`
+	Model       string `json:"model"`
+	ContextName string `json:"contextName"`
+	PatternName string `json:"patternName"`
+}
+
+// restStreamEvent is one "data:" line of the /chat event stream
+type restStreamEvent struct {
+	Type    string `json:"type"`
+	Format  string `json:"format"`
+	Content string `json:"content"`
+}
+
+func (b *RESTBackend) RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
+	prompt := restPrompt{UserInput: input, PatternName: pattern}
+	if model != "" && model != "default" {
+		vendor, err := b.vendorFor(ctx, model)
+		if err != nil {
+			return "", err
+		}
+		prompt.Vendor = vendor
+		prompt.Model = model
+	}
+	body, err := json.Marshal(restChatRequest{Prompts: []restPrompt{prompt}})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", b.baseURL+"/chat", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling fabric server: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("fabric server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var output strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var event restStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return "", fmt.Errorf("error parsing fabric server response: %v", err)
+		}
+		switch event.Type {
+		case "content":
+			output.WriteString(event.Content)
+			if onChunk != nil {
+				onChunk(event.Content)
+			}
+		case "error":
+			return "", fmt.Errorf("fabric server error: %s", event.Content)
+		case "complete":
+			return output.String(), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading fabric server response: %v", err)
+	}
+	return "", fmt.Errorf("fabric server closed the response before completing")
+}
+
+func (b *RESTBackend) ListPatterns(ctx context.Context) ([]string, error) {
+	var patterns []string
+	if err := b.getJSON(ctx, "/patterns/names", &patterns); err != nil {
+		return nil, fmt.Errorf("error listing patterns: %v", err)
+	}
+	sort.Strings(patterns)
+	return patterns, nil
+}
+
+func (b *RESTBackend) ListModels(ctx context.Context) ([]Model, error) {
+	vendors, err := b.modelsByVendor(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing models: %v", err)
+	}
+
+	providers := make([]string, 0, len(vendors))
+	for provider := range vendors {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	var models []Model
+	for _, provider := range providers {
+		for _, name := range vendors[provider] {
+			models = append(models, Model{Provider: provider, Name: name})
+		}
+	}
+	return models, nil
+}
+
+// vendorFor finds the vendor serving a model, which the chat endpoint requires alongside the model name
+func (b *RESTBackend) vendorFor(ctx context.Context, model string) (string, error) {
+	vendors, err := b.modelsByVendor(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error listing models: %v", err)
+	}
+	for vendor, names := range vendors {
+		for _, name := range names {
+			if name == model {
+				return vendor, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("model %q is not available on the fabric server", model)
+}
+
+func (b *RESTBackend) modelsByVendor(ctx context.Context) (map[string][]string, error) {
+	var response struct {
+		Vendors map[string][]string `json:"vendors"`
+	}
+	if err := b.getJSON(ctx, "/models/names", &response); err != nil {
+		return nil, err
+	}
+	return response.Vendors, nil
+}
+
+func (b *RESTBackend) getJSON(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fabric server returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
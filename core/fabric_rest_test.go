@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestFabricServer fakes `fabric --serve`. Its /chat endpoint streams the
+// given events, one "data:" line each, and records the last request.
+func newTestFabricServer(t *testing.T, events ...restStreamEvent) (*RESTBackend, *restChatRequest) {
+	t.Helper()
+	var last restChatRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chat", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&last); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+	})
+	mux.HandleFunc("/patterns/names", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{"summarize", "extract_wisdom", "analyze_claims"})
+	})
+	mux.HandleFunc("/models/names", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"vendors": map[string][]string{
+				"Ollama": {"llama3"},
+				"OpenAI": {"gpt-4o", "gpt-4o-mini"},
+			},
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return NewRESTBackend(server.URL + "/"), &last
+}
+
+func TestRESTBackendRunPattern(t *testing.T) {
+	content := func(text string) restStreamEvent {
+		return restStreamEvent{Type: "content", Format: "markdown", Content: text}
+	}
+	tests := []struct {
+		name    string
+		events  []restStreamEvent
+		want    string
+		wantErr string
+	}{
+		{"complete", []restStreamEvent{content("Hello, "), content("world"), {Type: "complete"}}, "Hello, world", ""},
+		{"error event", []restStreamEvent{content("Hel"), {Type: "error", Content: "rate limited"}}, "", "rate limited"},
+		{"closed early", []restStreamEvent{content("Hello, ")}, "", "before completing"},
+		{"empty stream", nil, "", "before completing"},
+	}
+	for _, tt := range tests {
+		backend, request := newTestFabricServer(t, tt.events...)
+		var chunks []string
+		output, err := backend.RunPattern(context.Background(), "transcript", "summarize", "gpt-4o", func(chunk string) {
+			chunks = append(chunks, chunk)
+		})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if output != tt.want || strings.Join(chunks, "") != tt.want {
+			t.Errorf("%s: output %q streamed as %q, want %q", tt.name, output, chunks, tt.want)
+		}
+		want := restPrompt{UserInput: "transcript", Vendor: "OpenAI", Model: "gpt-4o", PatternName: "summarize"}
+		if len(request.Prompts) != 1 || request.Prompts[0] != want {
+			t.Errorf("%s: sent %+v, want %+v", tt.name, request.Prompts, want)
+		}
+	}
+}
+
+func TestRESTBackendDefaultModel(t *testing.T) {
+	backend, request := newTestFabricServer(t, restStreamEvent{Type: "complete"})
+	if _, err := backend.RunPattern(context.Background(), "transcript", "summarize", "default", nil); err != nil {
+		t.Fatal(err)
+	}
+	if prompt := request.Prompts[0]; prompt.Vendor != "" || prompt.Model != "" {
+		t.Errorf("default model sent vendor %q model %q, want the server's default", prompt.Vendor, prompt.Model)
+	}
+
+	if _, err := backend.RunPattern(context.Background(), "transcript", "summarize", "missing", nil); err == nil {
+		t.Error("unknown model ran")
+	}
+}
+
+func TestRESTBackendLists(t *testing.T) {
+	backend, _ := newTestFabricServer(t)
+	patterns, err := backend.ListPatterns(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"analyze_claims", "extract_wisdom", "summarize"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("ListPatterns = %v, want %v", patterns, want)
+	}
+
+	models, err := backend.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Model{
+		{Provider: "Ollama", Name: "llama3"},
+		{Provider: "OpenAI", Name: "gpt-4o"},
+		{Provider: "OpenAI", Name: "gpt-4o-mini"},
+	}
+	if !reflect.DeepEqual(models, want) {
+		t.Errorf("ListModels = %v, want %v", models, want)
+	}
+}
+
+func TestFallbackBackend(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+	truncated, _ := newTestFabricServer(t, restStreamEvent{Type: "content", Content: "partial"})
+	tests := []struct {
+		name         string
+		primary      *RESTBackend
+		want         string
+		wantErr      bool
+		wantFallback bool
+	}{
+		{"primary down", NewRESTBackend(down.URL), "from fallback", false, true},
+		// Output the user has already seen is not replaced by another run
+		{"failed after streaming", truncated, "", true, false},
+	}
+	for _, tt := range tests {
+		fallback := &stubBackend{name: "fallback", output: "from fallback"}
+		backend := &FallbackBackend{Primary: tt.primary, Fallback: fallback, Logger: testLogger()}
+		output, err := backend.RunPattern(context.Background(), "transcript", "summarize", "default", func(string) {})
+		if (err != nil) != tt.wantErr || output != tt.want {
+			t.Errorf("%s: got %q, %v; want %q, error %v", tt.name, output, err, tt.want, tt.wantErr)
+		}
+		if (fallback.runs > 0) != tt.wantFallback {
+			t.Errorf("%s: fallback ran %d times", tt.name, fallback.runs)
+		}
+	}
+
+	backend := &FallbackBackend{Primary: NewRESTBackend(down.URL), Fallback: &stubBackend{name: "fallback"}, Logger: testLogger()}
+	patterns, err := backend.ListPatterns(context.Background())
+	if err != nil || !reflect.DeepEqual(patterns, []string{"fallback_pattern"}) {
+		t.Errorf("ListPatterns = %v, %v; want the fallback's patterns", patterns, err)
+	}
+	models, err := backend.ListModels(context.Background())
+	if err != nil || len(models) != 1 || models[0].Provider != "fallback" {
+		t.Errorf("ListModels = %v, %v; want the fallback's models", models, err)
+	}
+}
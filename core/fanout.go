@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// JobFanOut is the job kind running several patterns and models over a video at once
+const JobFanOut = "fanout"
+
+// providerLimiter bounds how many runs may use each provider at the same time
+type providerLimiter struct {
+	limit int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// acquire waits for a free slot for the provider and returns the function releasing it
+func (l *providerLimiter) acquire(ctx context.Context, provider string) (func(), error) {
+	if l == nil || l.limit <= 0 {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	slot, ok := l.slots[provider]
+	if !ok {
+		slot = make(chan struct{}, l.limit)
+		l.slots[provider] = slot
+	}
+	l.mu.Unlock()
+
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SetProviderConcurrency limits how many pattern runs may use the same
+// provider at once. Runs on the default model share one limit. Zero means
+// no limit.
+func (p *Processor) SetProviderConcurrency(limit int) {
+	p.providers = &providerLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// EnqueueFanOut queues a job running every combination of the given patterns
+// and models over a video in parallel
+func (p *Processor) EnqueueFanOut(videoID string, models []string, patterns []string) (Job, error) {
+	if len(models) == 0 || len(patterns) == 0 {
+		return Job{}, fmt.Errorf("select at least one model and one pattern")
+	}
+	description := fmt.Sprintf("Run %s with %s on %s", strings.Join(patterns, ", "), strings.Join(models, ", "), videoID)
+	return p.jobs.Enqueue(JobFanOut, description, map[string]string{
+		"videoID":  videoID,
+		"models":   strings.Join(models, "\n"),
+		"patterns": strings.Join(patterns, "\n"),
+	})
+}
+
+// runFanOutJob runs the cross product of patterns and models concurrently and
+// links to the compare view of the runs that succeeded. No more runs go at
+// once than the queue has workers, on top of the per provider limit, which
+// may be off. Each run reports a progress line when it finishes rather than
+// streaming, since the outputs would interleave.
+func (p *Processor) runFanOutJob(ctx context.Context, job Job, progress func(string)) (string, error) {
+	videoID := job.Params["videoID"]
+	models := strings.Split(job.Params["models"], "\n")
+	patterns := strings.Split(job.Params["patterns"], "\n")
+	video, err := p.store.LoadVideo(videoID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load video: %v", err)
+	}
+	if video == nil {
+		return "", fmt.Errorf("video %s not found", videoID)
+	}
+
+	type result struct {
+		run *Run
+		err error
+	}
+	results := make([]result, len(patterns)*len(models))
+	slots := make(chan struct{}, p.jobs.Workers())
+	var wg sync.WaitGroup
+	for i, pattern := range patterns {
+		for j, model := range models {
+			index := i*len(models) + j
+			if err := ctx.Err(); err != nil {
+				results[index] = result{err: err}
+				continue
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				results[index] = result{err: ctx.Err()}
+				continue
+			}
+			wg.Add(1)
+			go func(index int, pattern string, model string) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				run, _, err := p.recordRun(ctx, videoID, pattern, model, video.Transcript, func(ctx context.Context, run *Run) (string, error) {
+					return p.runPattern(ctx, run, *video, nil)
+				})
+				results[index] = result{run: run, err: err}
+				if err != nil {
+					progress(fmt.Sprintf("- %s with %s failed: %v\n", pattern, model, err))
+				} else {
+					progress(fmt.Sprintf("- %s with %s done in %s\n", pattern, model, run.Duration()))
+				}
+			}(index, pattern, model)
+		}
+	}
+	wg.Wait()
+
+	query := url.Values{}
+	var failures []string
+	for _, r := range results {
+		if r.err != nil {
+			failures = append(failures, r.err.Error())
+			continue
+		}
+		query.Add("run", r.run.ID)
+	}
+	switch len(query["run"]) {
+	case 0:
+		return "", fmt.Errorf("all %d runs failed: %s", len(results), strings.Join(failures, "; "))
+	case 1:
+		return fmt.Sprintf("/videos/%s/runs/%s", videoID, query.Get("run")), nil
+	}
+	if len(failures) > 0 {
+		p.logger.Warn("Some fan-out runs failed", "videoID", videoID, "failed", len(failures), "total", len(results))
+	}
+	return fmt.Sprintf("/videos/%s/compare?%s", videoID, query.Encode()), nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fabric-agents/yt"
+)
+
+// concurrencyBackend records how many runs it serves at the same time
+type concurrencyBackend struct {
+	stubBackend
+
+	mu            sync.Mutex
+	running, most int
+}
+
+func (b *concurrencyBackend) RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
+	b.mu.Lock()
+	b.running++
+	if b.running > b.most {
+		b.most = b.running
+	}
+	b.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	b.mu.Lock()
+	b.running--
+	b.mu.Unlock()
+	return pattern + " with " + model, nil
+}
+
+func TestFanOutBoundedByWorkers(t *testing.T) {
+	tests := []struct {
+		name               string
+		workers, providers int
+		wantMost           int
+	}{
+		{"no provider limit", 2, 0, 2},
+		{"provider limit below workers", 4, 1, 1},
+	}
+	for _, tt := range tests {
+		p, _ := newTestProcessor(t)
+		backend := &concurrencyBackend{stubBackend: stubBackend{name: "stub"}}
+		p.SetBackend(backend)
+		p.SetProviderConcurrency(tt.providers)
+		p.RegisterJobs(NewJobQueue(testLogger(), p.Store(), tt.workers))
+		if err := p.Store().SaveVideo(yt.Video{ID: "aaaaaaaaaa1", Title: "Video", Transcript: "Hello."}); err != nil {
+			t.Fatal(err)
+		}
+
+		var mu sync.Mutex
+		var progress strings.Builder
+		job := Job{Params: map[string]string{
+			"videoID":  "aaaaaaaaaa1",
+			"models":   "m1\nm2",
+			"patterns": "p1\np2\np3",
+		}}
+		link, err := p.runFanOutJob(context.Background(), job, func(text string) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress.WriteString(text)
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if backend.most > tt.wantMost {
+			t.Errorf("%s: %d runs went at once, want at most %d", tt.name, backend.most, tt.wantMost)
+		}
+		compare, err := url.Parse(link)
+		if err != nil || compare.Path != "/videos/aaaaaaaaaa1/compare" || len(compare.Query()["run"]) != 6 {
+			t.Errorf("%s: link = %q, want a comparison of all 6 runs", tt.name, link)
+		}
+		if got := strings.Count(progress.String(), " done in "); got != 6 {
+			t.Errorf("%s: progress reports %d finished runs, want 6", tt.name, got)
+		}
+	}
+}
+
+func TestFanOutStopsStartingRunsWhenCancelled(t *testing.T) {
+	p, _ := newTestProcessor(t)
+	backend := &concurrencyBackend{stubBackend: stubBackend{name: "stub"}}
+	p.SetBackend(backend)
+	p.RegisterJobs(NewJobQueue(testLogger(), p.Store(), 1))
+	if err := p.Store().SaveVideo(yt.Video{ID: "aaaaaaaaaa1", Title: "Video", Transcript: "Hello."}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	job := Job{Params: map[string]string{"videoID": "aaaaaaaaaa1", "models": "m1", "patterns": "p1\np2\np3"}}
+	if _, err := p.runFanOutJob(ctx, job, func(string) {}); err == nil {
+		t.Error("cancelled fan-out succeeded")
+	}
+	if backend.most != 0 {
+		t.Error("runs started after the job was cancelled")
+	}
+}
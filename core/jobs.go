@@ -0,0 +1,431 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Done reports whether the job has reached a final state
+func (s JobState) Done() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// Job is a unit of background work. Everything a job needs to run is kept in
+// Params so a job can be described, listed and retried without its closure.
+type Job struct {
+	ID          string            `json:"id"`
+	Kind        string            `json:"kind"`
+	Description string            `json:"description"`
+	Params      map[string]string `json:"params"`
+	State       JobState          `json:"state"`
+	// Result links to whatever the job produced, e.g. a video or output page
+	Result     string    `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// Duration returns how long the job ran, or has been running so far
+func (j Job) Duration() time.Duration {
+	if j.StartedAt.IsZero() {
+		return 0
+	}
+	if j.FinishedAt.IsZero() {
+		return time.Since(j.StartedAt).Round(time.Second)
+	}
+	return j.FinishedAt.Sub(j.StartedAt).Round(time.Second)
+}
+
+// JobFunc runs a job of one kind and returns its result link. Output passed
+// to progress is streamed to anyone watching the job. The context is
+// cancelled when the job is cancelled while running.
+type JobFunc func(ctx context.Context, job Job, progress func(string)) (string, error)
+
+// jobOutputRetention is how long the streamed output of a finished job stays
+// available so late watchers can still read the end of it
+const jobOutputRetention = time.Minute
+
+// jobOutput is the output a running job has streamed so far and the watchers waiting on it
+type jobOutput struct {
+	text     strings.Builder
+	watchers map[chan struct{}]bool
+}
+
+func (o *jobOutput) notify() {
+	for watcher := range o.watchers {
+		select {
+		case watcher <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// JobQueue runs jobs on a fixed number of workers in the order they were
+// enqueued. Every job is saved to the store whenever its state changes, so the
+// queue and its history survive restarts.
+type JobQueue struct {
+	logger   *slog.Logger
+	store    JobStore
+	workers  int
+	handlers map[string]JobFunc
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    map[string]*Job
+	pending []string
+	outputs map[string]*jobOutput
+	cancels map[string]context.CancelFunc
+}
+
+func NewJobQueue(logger *slog.Logger, store JobStore, workers int) *JobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &JobQueue{
+		logger:   logger,
+		store:    store,
+		workers:  workers,
+		handlers: make(map[string]JobFunc),
+		jobs:     make(map[string]*Job),
+		outputs:  make(map[string]*jobOutput),
+		cancels:  make(map[string]context.CancelFunc),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Register sets the function that runs jobs of the given kind. Call it before Start.
+func (q *JobQueue) Register(kind string, fn JobFunc) {
+	q.handlers[kind] = fn
+}
+
+// Workers returns how many jobs run at the same time
+func (q *JobQueue) Workers() int {
+	return q.workers
+}
+
+// Start restores the saved jobs and launches the worker pool. Jobs that were
+// still queued are resumed; jobs that were running when the server stopped
+// are marked as failed since their work was lost.
+func (q *JobQueue) Start() error {
+	jobs, corrupt, err := q.store.LoadJobs()
+	if err != nil {
+		return fmt.Errorf("failed to load jobs: %v", err)
+	}
+	for _, job := range corrupt {
+		q.logger.Warn("Skipping corrupt job", "jobID", job.ID, "error", job.Error)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range jobs {
+		job := &jobs[i]
+		switch job.State {
+		case JobQueued:
+			q.pending = append(q.pending, job.ID)
+		case JobRunning:
+			job.State = JobFailed
+			job.Error = "interrupted by server restart"
+			job.FinishedAt = time.Now()
+			q.save(job)
+		}
+		q.jobs[job.ID] = job
+	}
+	q.logger.Info("Jobs restored", "total", len(jobs), "resumed", len(q.pending))
+
+	for i := 0; i < q.workers; i++ {
+		go q.work()
+	}
+	return nil
+}
+
+// Enqueue adds a job and returns a copy of it in its queued state
+func (q *JobQueue) Enqueue(kind string, description string, params map[string]string) (Job, error) {
+	if _, ok := q.handlers[kind]; !ok {
+		return Job{}, fmt.Errorf("unknown job kind %q", kind)
+	}
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:          id,
+		Kind:        kind,
+		Description: description,
+		Params:      params,
+		State:       JobQueued,
+		CreatedAt:   time.Now(),
+	}
+
+	q.mu.Lock()
+	q.jobs[id] = job
+	q.pending = append(q.pending, id)
+	q.save(job)
+	q.mu.Unlock()
+	q.cond.Signal()
+
+	q.logger.Info("Job queued", "jobID", id, "kind", kind, "description", description)
+	return *job, nil
+}
+
+// Get returns a copy of a job
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns copies of all jobs, newest first
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	q.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Output returns the output a job has streamed so far
+func (q *JobQueue) Output(id string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if output, ok := q.outputs[id]; ok {
+		return output.text.String()
+	}
+	return ""
+}
+
+// Watch returns a channel that is signalled whenever the job streams output
+// or changes state, and a function to stop watching
+func (q *JobQueue) Watch(id string) (<-chan struct{}, func()) {
+	watcher := make(chan struct{}, 1)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	output := q.outputFor(id)
+	output.watchers[watcher] = true
+	return watcher, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		delete(output.watchers, watcher)
+		if job, ok := q.jobs[id]; len(output.watchers) == 0 && (!ok || job.State.Done()) && q.outputs[id] == output {
+			delete(q.outputs, id)
+		}
+	}
+}
+
+// outputFor returns the job's output buffer, creating it if needed. Call with q.mu held.
+func (q *JobQueue) outputFor(id string) *jobOutput {
+	output, ok := q.outputs[id]
+	if !ok {
+		output = &jobOutput{watchers: make(map[chan struct{}]bool)}
+		q.outputs[id] = output
+	}
+	return output
+}
+
+// Cancel cancels a queued job, or stops a running one. A running job is
+// recorded as cancelled once its function returns.
+func (q *JobQueue) Cancel(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+	if job.State == JobRunning {
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+			q.logger.Info("Job cancellation requested", "jobID", id)
+		}
+		return nil
+	}
+	if job.State != JobQueued {
+		return fmt.Errorf("job %s is %s", id, job.State)
+	}
+	job.State = JobCancelled
+	job.FinishedAt = time.Now()
+	q.save(job)
+	if output, ok := q.outputs[id]; ok {
+		output.notify()
+	}
+	q.logger.Info("Job cancelled", "jobID", id)
+	return nil
+}
+
+func (q *JobQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 {
+			q.cond.Wait()
+		}
+		id := q.pending[0]
+		q.pending = q.pending[1:]
+		job := q.jobs[id]
+		if job.State != JobQueued {
+			// Cancelled while waiting
+			q.mu.Unlock()
+			continue
+		}
+		job.State = JobRunning
+		job.StartedAt = time.Now()
+		q.save(job)
+		snapshot := *job
+		output := q.outputFor(id)
+		output.notify()
+		ctx, cancel := context.WithCancel(context.Background())
+		q.cancels[id] = cancel
+		q.mu.Unlock()
+
+		progress := func(chunk string) {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			output.text.WriteString(chunk)
+			output.notify()
+		}
+
+		q.logger.Info("Job started", "jobID", id, "kind", snapshot.Kind)
+		var result string
+		var err error
+		if handler, ok := q.handlers[snapshot.Kind]; ok {
+			result, err = handler(ctx, snapshot, progress)
+		} else {
+			// A job restored from disk whose kind is no longer registered
+			err = fmt.Errorf("unknown job kind %q", snapshot.Kind)
+		}
+
+		q.mu.Lock()
+		cancelled := ctx.Err() != nil
+		cancel()
+		delete(q.cancels, id)
+		job.FinishedAt = time.Now()
+		job.Result = result
+		switch {
+		case err != nil && cancelled:
+			job.State = JobCancelled
+			job.Error = err.Error()
+		case err != nil:
+			job.State = JobFailed
+			job.Error = err.Error()
+		default:
+			job.State = JobSucceeded
+		}
+		state := job.State
+		q.save(job)
+		output.notify()
+		q.mu.Unlock()
+		time.AfterFunc(jobOutputRetention, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			delete(q.outputs, id)
+		})
+
+		switch state {
+		case JobSucceeded:
+			q.logger.Info("Job succeeded", "jobID", id, "kind", snapshot.Kind, "result", result)
+		case JobCancelled:
+			q.logger.Info("Job cancelled", "jobID", id, "kind", snapshot.Kind, "error", err)
+		default:
+			q.logger.Error("Job failed", "jobID", id, "kind", snapshot.Kind, "error", err)
+		}
+	}
+}
+
+// save writes a job to the store. It is called with q.mu held so writes for the
+// same job land in order; failures are logged because the in-memory state
+// stays authoritative until the next restart.
+func (q *JobQueue) save(job *Job) {
+	if err := q.store.SaveJob(*job); err != nil {
+		q.logger.Error("Failed to save job", "jobID", job.ID, "error", err)
+	}
+}
+
+func SaveJob(job Job, dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dataDir, job.ID+".json"), jobJSON, 0644)
+}
+
+// CorruptJob is a saved job that could not be read. It is skipped on load
+// and reported instead of keeping the queue from starting.
+type CorruptJob struct {
+	ID    string
+	Error string
+}
+
+// LoadJobs loads all saved jobs, oldest first, skipping those that can't be read
+func LoadJobs(dataDir string) ([]Job, []CorruptJob, error) {
+	files, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var jobs []Job
+	var corrupt []CorruptJob
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		id := strings.TrimSuffix(file.Name(), ".json")
+		jobJSON, err := os.ReadFile(filepath.Join(dataDir, file.Name()))
+		if err != nil {
+			corrupt = append(corrupt, CorruptJob{ID: id, Error: err.Error()})
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(jobJSON, &job); err != nil {
+			corrupt = append(corrupt, CorruptJob{ID: id, Error: err.Error()})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs, corrupt, nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %v", err)
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStartSkipsCorruptJobs(t *testing.T) {
+	dataDir := t.TempDir()
+	sqliteStore, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "fabric.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteStore.Close()
+	fsStore := NewFSStore(dataDir)
+
+	// A job file cut short by a crash, and the same job as a database row
+	if err := os.MkdirAll(filepath.Join(dataDir, "jobs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "jobs", "20260101-000000-deadbeef.json"), []byte(`{"id": "20260101-00`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqliteStore.db.Exec(`INSERT INTO jobs (id, state, created_at, data) VALUES (?, ?, ?, ?)`,
+		"20260101-000000-deadbeef", "queued", "2026-01-01T00:00:00.000000000Z", `{"id": "20260101-00`); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]Store{"fs": fsStore, "sqlite": sqliteStore} {
+		good := Job{ID: "20260102-000000-0badf00d", Kind: "test", State: JobSucceeded, CreatedAt: time.Now()}
+		if err := store.SaveJob(good); err != nil {
+			t.Fatal(err)
+		}
+		jobs, corrupt, err := store.LoadJobs()
+		if err != nil {
+			t.Fatalf("%s: LoadJobs failed: %v", name, err)
+		}
+		if len(jobs) != 1 || jobs[0].ID != good.ID {
+			t.Errorf("%s: loaded %v, want only the readable job", name, jobs)
+		}
+		if len(corrupt) != 1 || corrupt[0].ID != "20260101-000000-deadbeef" || corrupt[0].Error == "" {
+			t.Errorf("%s: corrupt = %v, want the truncated job", name, corrupt)
+		}
+
+		q := NewJobQueue(testLogger(), store, 1)
+		if err := q.Start(); err != nil {
+			t.Fatalf("%s: Start failed on a corrupt job: %v", name, err)
+		}
+		if _, ok := q.Get(good.ID); !ok {
+			t.Errorf("%s: readable job not restored", name)
+		}
+	}
+}
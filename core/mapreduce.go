@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"fabric-agents/yt"
+	"fmt"
+	"strings"
+)
+
+// SetChunking enables map-reduce processing for transcripts estimated to be
+// longer than maxTokens. Each chunk is run through the requested pattern and
+// the chunk outputs are merged with reducePattern, or with the requested
+// pattern again when reducePattern is empty. Zero maxTokens disables chunking.
+func (p *Processor) SetChunking(maxTokens int, reducePattern string) {
+	p.maxInputTokens = maxTokens
+	p.reducePattern = reducePattern
+}
+
+// runPattern runs the run's pattern over a video's transcript, switching to
+// map-reduce when the transcript is too long for a single run
+func (p *Processor) runPattern(ctx context.Context, run *Run, video yt.Video, onChunk func(string)) (string, error) {
+	if p.maxInputTokens <= 0 || EstimateTokens(video.Transcript) <= p.maxInputTokens {
+		return p.backend.RunPattern(ctx, video.Transcript, run.Pattern, run.Model, onChunk)
+	}
+	return p.mapReduce(ctx, run, video, onChunk)
+}
+
+// mapReduce runs the pattern over each chunk of the transcript, keeps every
+// chunk output with the run for inspection, then merges them with
+// the reduce pattern. When the chunk outputs together are still too long for
+// one run, they are first merged in groups, round after round, until they
+// fit. Only the final merge is streamed; the other steps report progress
+// lines instead.
+func (p *Processor) mapReduce(ctx context.Context, run *Run, video yt.Video, onChunk func(string)) (string, error) {
+	pattern, model := run.Pattern, run.Model
+	chunks := ChunkTranscript(video, p.maxInputTokens)
+	run.Chunks = len(chunks)
+	p.logger.Info("Transcript too long, processing in chunks", "videoID", video.ID, "chunks", len(chunks), "maxTokens", p.maxInputTokens)
+
+	outputs := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		if onChunk != nil {
+			onChunk(fmt.Sprintf("_Running %s on part %d of %d..._\n\n", pattern, i+1, len(chunks)))
+		}
+		output, err := p.backend.RunPattern(ctx, chunk.Text, pattern, model, nil)
+		if err != nil {
+			return "", fmt.Errorf("part %d of %d: %v", i+1, len(chunks), err)
+		}
+		if err := p.store.SaveRunChunk(video.ID, run.ID, i+1, output); err != nil {
+			p.logger.Warn("Failed to save chunk output", "videoID", video.ID, "chunk", i+1, "error", err)
+		}
+		outputs[i] = output
+	}
+
+	reducePattern := p.reducePattern
+	if reducePattern == "" {
+		reducePattern = pattern
+	}
+	for round := 1; EstimateTokens(joinParts(outputs)) > p.maxInputTokens; round++ {
+		groups := groupParts(outputs, p.maxInputTokens)
+		if len(groups) == len(outputs) {
+			return "", fmt.Errorf("the outputs of %d parts are too long to merge within %d tokens", len(outputs), p.maxInputTokens)
+		}
+		p.logger.Info("Part outputs too long to merge at once, merging in groups", "videoID", video.ID, "round", round, "parts", len(outputs), "groups", len(groups))
+		merged := make([]string, len(groups))
+		first := 1
+		for i, group := range groups {
+			if onChunk != nil {
+				onChunk(fmt.Sprintf("_Merging parts %d to %d of %d with %s..._\n\n", first, first+len(group)-1, len(outputs), reducePattern))
+			}
+			output, err := p.backend.RunPattern(ctx, joinParts(group), reducePattern, model, nil)
+			if err != nil {
+				return "", fmt.Errorf("merging parts %d to %d of %d: %v", first, first+len(group)-1, len(outputs), err)
+			}
+			merged[i] = output
+			first += len(group)
+		}
+		outputs = merged
+	}
+
+	if onChunk != nil {
+		onChunk(fmt.Sprintf("_Merging %d parts with %s..._\n\n", len(outputs), reducePattern))
+	}
+	return p.backend.RunPattern(ctx, joinParts(outputs), reducePattern, model, onChunk)
+}
+
+// joinParts joins part outputs under headers numbering them, as the input of
+// the reduce pattern
+func joinParts(outputs []string) string {
+	var combined strings.Builder
+	for i, output := range outputs {
+		fmt.Fprintf(&combined, "## Part %d of %d\n\n%s\n\n", i+1, len(outputs), strings.TrimSpace(output))
+	}
+	return combined.String()
+}
+
+// groupParts splits part outputs, in order, into groups whose joined text
+// fits within maxTokens. An output too long to fit by itself gets a group of
+// its own.
+func groupParts(outputs []string, maxTokens int) [][]string {
+	var groups [][]string
+	var current []string
+	for _, output := range outputs {
+		if len(current) > 0 && EstimateTokens(joinParts(append(current, output))) > maxTokens {
+			groups = append(groups, current)
+			current = nil
+		}
+		current = append(current, output)
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+// scriptedBackend answers each run with reply and records every call
+type scriptedBackend struct {
+	reply func(input, pattern string) string
+	calls []scriptedCall
+}
+
+type scriptedCall struct {
+	input, pattern string
+}
+
+func (b *scriptedBackend) Name() string {
+	return "scripted"
+}
+
+func (b *scriptedBackend) RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
+	b.calls = append(b.calls, scriptedCall{input, pattern})
+	output := b.reply(input, pattern)
+	if onChunk != nil {
+		onChunk(output)
+	}
+	return output, nil
+}
+
+func (b *scriptedBackend) ListPatterns(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (b *scriptedBackend) ListModels(ctx context.Context) ([]Model, error) {
+	return nil, nil
+}
+
+// longVideo returns a video whose transcript has the given number of
+// sentences of about 37 estimated tokens each
+func longVideo(sentences int) yt.Video {
+	var transcript strings.Builder
+	for i := 1; i <= sentences; i++ {
+		fmt.Fprintf(&transcript, "Sentence %02d %s. ", i, strings.Repeat("x", 130))
+	}
+	return yt.Video{ID: "aaaaaaaaaa1", Title: "Long", Transcript: transcript.String()}
+}
+
+func newMapReduceTest(t *testing.T, maxTokens int, reply func(input, pattern string) string) (*Processor, *scriptedBackend, *Run) {
+	t.Helper()
+	p, _ := newTestProcessor(t)
+	backend := &scriptedBackend{reply: reply}
+	p.SetBackend(backend)
+	p.SetChunking(maxTokens, "merge")
+	if err := p.Store().SaveVideo(longVideo(1)); err != nil {
+		t.Fatal(err)
+	}
+	return p, backend, &Run{ID: "20260101-120000-00000001", VideoID: "aaaaaaaaaa1", Pattern: "summarize", Model: "default"}
+}
+
+func TestRunPatternShortTranscript(t *testing.T) {
+	p, backend, run := newMapReduceTest(t, 50, func(input, pattern string) string { return "summary" })
+	output, err := p.runPattern(context.Background(), run, yt.Video{ID: "aaaaaaaaaa1", Transcript: "Short."}, nil)
+	if err != nil || output != "summary" {
+		t.Fatalf("runPattern = %q, %v", output, err)
+	}
+	if len(backend.calls) != 1 || backend.calls[0].input != "Short." || run.Chunks != 0 {
+		t.Errorf("calls = %+v, chunks = %d; want one plain run", backend.calls, run.Chunks)
+	}
+}
+
+func TestMapReduce(t *testing.T) {
+	p, backend, run := newMapReduceTest(t, 50, func(input, pattern string) string {
+		if pattern == "merge" {
+			return "merged"
+		}
+		return "summary of " + input[:len("Sentence 00")]
+	})
+	var progress strings.Builder
+	output, err := p.runPattern(context.Background(), run, longVideo(3), func(chunk string) { progress.WriteString(chunk) })
+	if err != nil || output != "merged" {
+		t.Fatalf("runPattern = %q, %v", output, err)
+	}
+	if run.Chunks != 3 || len(backend.calls) != 4 {
+		t.Fatalf("chunks = %d, calls = %d; want 3 parts and a merge", run.Chunks, len(backend.calls))
+	}
+	reduce := backend.calls[3]
+	if reduce.pattern != "merge" || !strings.Contains(reduce.input, "## Part 3 of 3\n\nsummary of Sentence 03") {
+		t.Errorf("reduce call = %+v", reduce)
+	}
+	chunks, err := p.Store().LoadRunChunks(run.VideoID, run.ID)
+	if err != nil || strings.Join(chunks, "|") != "summary of Sentence 01|summary of Sentence 02|summary of Sentence 03" {
+		t.Errorf("saved parts = %q, %v", chunks, err)
+	}
+	if !strings.Contains(progress.String(), "part 3 of 3") || !strings.HasSuffix(progress.String(), "merged") {
+		t.Errorf("progress = %q", progress.String())
+	}
+}
+
+func TestMapReduceMergesInRounds(t *testing.T) {
+	// Each output is 15 tokens: two fit in one merge, three don't
+	p, backend, run := newMapReduceTest(t, 50, func(input, pattern string) string {
+		return strings.Repeat("o", 60)
+	})
+	output, err := p.runPattern(context.Background(), run, longVideo(10), nil)
+	if err != nil || output != strings.Repeat("o", 60) {
+		t.Fatalf("runPattern = %q, %v", output, err)
+	}
+	merges := 0
+	for _, call := range backend.calls {
+		if tokens := EstimateTokens(call.input); tokens > 50 {
+			t.Errorf("%s ran over %d tokens", call.pattern, tokens)
+		}
+		if call.pattern == "merge" {
+			merges++
+		}
+	}
+	// 10 parts merge into 5, then 3, then 2, then the final merge
+	if run.Chunks != 10 || merges != 5+3+2+1 {
+		t.Errorf("chunks = %d, merges = %d; want 10 and 11", run.Chunks, merges)
+	}
+}
+
+func TestMapReduceOutputsTooLong(t *testing.T) {
+	p, _, run := newMapReduceTest(t, 50, func(input, pattern string) string {
+		return strings.Repeat("o", 400)
+	})
+	if _, err := p.runPattern(context.Background(), run, longVideo(3), nil); err == nil || !strings.Contains(err.Error(), "too long to merge") {
+		t.Errorf("runPattern error = %v, want the outputs reported too long", err)
+	}
+}
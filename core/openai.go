@@ -0,0 +1,249 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OpenAIBackend runs fabric patterns without the fabric binary by reading
+// each pattern's system.md from a patterns directory and sending it, with
+// the input as the user message, to an OpenAI-compatible chat completions
+// endpoint such as Ollama, llama.cpp server or vLLM
+type OpenAIBackend struct {
+	baseURL      string
+	apiKey       string
+	defaultModel string
+	patternsDir  string
+	client       *http.Client
+}
+
+// NewOpenAIBackend creates a backend for the API at baseURL (with or without
+// the /v1 suffix). defaultModel is used when a run asks for the "default" model.
+func NewOpenAIBackend(baseURL, apiKey, defaultModel, patternsDir string) *OpenAIBackend {
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	return &OpenAIBackend{
+		baseURL:      baseURL,
+		apiKey:       apiKey,
+		defaultModel: defaultModel,
+		patternsDir:  patternsDir,
+		client:       &http.Client{},
+	}
+}
+
+func (b *OpenAIBackend) Name() string {
+	return "openai"
+}
+
+// ChatMessage is a single message in an OpenAI-style conversation
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (b *OpenAIBackend) RunPattern(ctx context.Context, input, pattern, model string, onChunk func(string)) (string, error) {
+	system, err := b.loadPattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	messages := []ChatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: input},
+	}
+	return b.complete(ctx, model, messages, onChunk)
+}
+
+// Chat sends a conversation as is
+func (b *OpenAIBackend) Chat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string)) (string, error) {
+	return b.complete(ctx, model, messages, onChunk)
+}
+
+// loadPattern reads a pattern's system prompt
+func (b *OpenAIBackend) loadPattern(pattern string) (string, error) {
+	if pattern == "" || filepath.Base(pattern) != pattern || strings.HasPrefix(pattern, ".") {
+		return "", fmt.Errorf("invalid pattern name %q", pattern)
+	}
+	system, err := os.ReadFile(filepath.Join(b.patternsDir, pattern, "system.md"))
+	if err != nil {
+		return "", fmt.Errorf("error loading pattern %s: %v", pattern, err)
+	}
+	return string(system), nil
+}
+
+// complete sends a conversation to the chat completions endpoint, streaming
+// the reply to onChunk when it is not nil. Replies cut short, by the model's
+// length limit or by the stream ending early, are errors rather than output.
+func (b *OpenAIBackend) complete(ctx context.Context, model string, messages []ChatMessage, onChunk func(string)) (string, error) {
+	if model == "" || model == "default" {
+		model = b.defaultModel
+	}
+	if model == "" {
+		return "", fmt.Errorf("no model selected and no default model configured")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":    model,
+		"messages": messages,
+		"stream":   onChunk != nil,
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := b.post(ctx, "/v1/chat/completions", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if onChunk == nil {
+		var response struct {
+			Choices []struct {
+				Message      ChatMessage `json:"message"`
+				FinishReason string      `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return "", fmt.Errorf("error parsing chat completion: %v", err)
+		}
+		if len(response.Choices) == 0 {
+			return "", fmt.Errorf("chat completion returned no choices")
+		}
+		if err := checkFinishReason(response.Choices[0].FinishReason); err != nil {
+			return "", err
+		}
+		return response.Choices[0].Message.Content, nil
+	}
+
+	var output strings.Builder
+	var finishReason string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			if err := checkFinishReason(finishReason); err != nil {
+				return "", err
+			}
+			return output.String(), nil
+		}
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return "", fmt.Errorf("error parsing chat completion stream: %v", err)
+		}
+		if len(event.Choices) == 0 {
+			continue
+		}
+		if event.Choices[0].FinishReason != "" {
+			finishReason = event.Choices[0].FinishReason
+		}
+		if event.Choices[0].Delta.Content != "" {
+			output.WriteString(event.Choices[0].Delta.Content)
+			onChunk(event.Choices[0].Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading chat completion stream: %v", err)
+	}
+	return "", fmt.Errorf("chat completion stream ended before [DONE]")
+}
+
+// checkFinishReason fails completions the model stopped before finishing
+func checkFinishReason(reason string) error {
+	if reason == "length" {
+		return fmt.Errorf("chat completion was cut off at the model's length limit")
+	}
+	return nil
+}
+
+// ListPatterns lists the directories in the patterns directory that contain a system.md
+func (b *OpenAIBackend) ListPatterns(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(b.patternsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing patterns: %v", err)
+	}
+	var patterns []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(b.patternsDir, entry.Name(), "system.md")); err == nil {
+			patterns = append(patterns, entry.Name())
+		}
+	}
+	sort.Strings(patterns)
+	return patterns, nil
+}
+
+func (b *OpenAIBackend) ListModels(ctx context.Context) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+"/v1/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	b.authorize(req)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error listing models: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error listing models: server returned %s", resp.Status)
+	}
+
+	var response struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error parsing model list: %v", err)
+	}
+	models := make([]Model, 0, len(response.Data))
+	for _, model := range response.Data {
+		models = append(models, Model{Provider: b.Name(), Name: model.ID})
+	}
+	return models, nil
+}
+
+func (b *OpenAIBackend) post(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", b.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	b.authorize(req)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func (b *OpenAIBackend) authorize(req *http.Request) {
+	if b.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+}
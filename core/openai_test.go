@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestOpenAIServer fakes a chat completions endpoint. Streamed requests
+// get the given lines, each sent as a "data:" line; other requests get reply
+// as the whole response body. The last request's messages are recorded.
+func newTestOpenAIServer(t *testing.T, lines []string, reply string) (*OpenAIBackend, *[]ChatMessage) {
+	t.Helper()
+	var messages []ChatMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		var request struct {
+			Messages []ChatMessage `json:"messages"`
+			Stream   bool          `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		messages = request.Messages
+		if !request.Stream {
+			fmt.Fprint(w, reply)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, line := range lines {
+			fmt.Fprintf(w, "data: %s\n\n", line)
+		}
+	}))
+	t.Cleanup(server.Close)
+	patternsDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(patternsDir, "summarize"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(patternsDir, "summarize", "system.md"), []byte("Summarize."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewOpenAIBackend(server.URL+"/v1/", "", "test-model", patternsDir), &messages
+}
+
+func TestOpenAIBackendStream(t *testing.T) {
+	delta := func(content string, finish string) string {
+		event := map[string]interface{}{"choices": []map[string]interface{}{{"delta": map[string]string{"content": content}, "finish_reason": finish}}}
+		data, _ := json.Marshal(event)
+		return string(data)
+	}
+	tests := []struct {
+		name    string
+		lines   []string
+		want    string
+		wantErr string
+	}{
+		{"complete", []string{delta("Hello, ", ""), delta("world", ""), delta("", "stop"), "[DONE]"}, "Hello, world", ""},
+		{"cut off by length", []string{delta("Hello, ", ""), delta("wor", "length"), "[DONE]"}, "", "length limit"},
+		{"closed early", []string{delta("Hello, ", "")}, "", "before [DONE]"},
+		{"empty stream", nil, "", "before [DONE]"},
+	}
+	for _, tt := range tests {
+		backend, messages := newTestOpenAIServer(t, tt.lines, "")
+		var chunks []string
+		output, err := backend.RunPattern(context.Background(), "transcript", "summarize", "default", func(chunk string) {
+			chunks = append(chunks, chunk)
+		})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got %q, %v; want an error about %q", tt.name, output, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if output != tt.want || strings.Join(chunks, "") != tt.want {
+			t.Errorf("%s: output %q streamed as %q, want %q", tt.name, output, chunks, tt.want)
+		}
+		want := []ChatMessage{{Role: "system", Content: "Summarize."}, {Role: "user", Content: "transcript"}}
+		if fmt.Sprint(*messages) != fmt.Sprint(want) {
+			t.Errorf("%s: sent %v, want %v", tt.name, *messages, want)
+		}
+	}
+}
+
+func TestOpenAIBackendComplete(t *testing.T) {
+	reply := func(content string, finish string) string {
+		return fmt.Sprintf(`{"choices": [{"message": {"role": "assistant", "content": %q}, "finish_reason": %q}]}`, content, finish)
+	}
+	tests := []struct {
+		name    string
+		reply   string
+		want    string
+		wantErr string
+	}{
+		{"complete", reply("An answer.", "stop"), "An answer.", ""},
+		{"cut off by length", reply("An ans", "length"), "", "length limit"},
+		{"no choices", `{"choices": []}`, "", "no choices"},
+	}
+	for _, tt := range tests {
+		backend, _ := newTestOpenAIServer(t, nil, tt.reply)
+		output, err := backend.Chat(context.Background(), "default", []ChatMessage{{Role: "user", Content: "Why?"}}, nil)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got %q, %v; want an error about %q", tt.name, output, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || output != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, output, err, tt.want)
+		}
+	}
+}
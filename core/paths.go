@@ -0,0 +1,117 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// uploadIDRegex matches the IDs given to videos imported from subtitle files
+var uploadIDRegex = regexp.MustCompile(`^` + UploadSourceName + `-[0-9a-f]{16}$`)
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ValidVideoID reports whether videoID is an ID one of the processor's
+// sources, or the subtitle importer, could have produced
+func (p *Processor) ValidVideoID(videoID string) bool {
+	if uploadIDRegex.MatchString(videoID) {
+		return true
+	}
+	for _, source := range p.sources {
+		if source.ValidVideoID(videoID) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidFileName reports whether name is a single plain file name: no path
+// separators, not "." or "..", and not hidden
+func ValidFileName(name string) bool {
+	if name == "" || len(name) > 255 || strings.HasPrefix(name, ".") {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\`+"\x00")
+}
+
+// SafeFileName turns a name such as a pattern or model into something
+// ValidFileName accepts, replacing anything but letters, digits, '.', '-'
+// and '_' with '_'
+func SafeFileName(name string) string {
+	name = unsafeFileNameChars.ReplaceAllString(name, "_")
+	name = strings.TrimLeft(name, ".")
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// OutputName returns the file name of an output of a pattern and model saved
+// before runs were recorded. Pattern and model names come from forms and may
+// hold any characters, so both are passed through SafeFileName.
+func OutputName(pattern string, model string) string {
+	return SafeFileName(pattern) + "-" + SafeFileName(model) + ".md"
+}
+
+// validOutputName checks a name is usable for a saved output: a plain file
+// name ending in .md
+func validOutputName(name string) error {
+	if !ValidFileName(name) || filepath.Ext(name) != ".md" {
+		return fmt.Errorf("invalid output name %q", name)
+	}
+	return nil
+}
+
+// validRunID checks a run's video and run IDs can name its files
+func validRunID(videoID string, runID string) error {
+	if !ValidFileName(videoID) {
+		return fmt.Errorf("invalid video ID %q", videoID)
+	}
+	if !ValidFileName(runID) || strings.ContainsAny(runID, "*?[") {
+		return fmt.Errorf("invalid run ID %q", runID)
+	}
+	return nil
+}
+
+// dataPath joins names under root, failing unless each is a plain file name
+// and the result stays inside root
+func dataPath(root string, names ...string) (string, error) {
+	for _, name := range names {
+		if !ValidFileName(name) {
+			return "", fmt.Errorf("invalid name %q", name)
+		}
+	}
+	root = filepath.Clean(root)
+	path := filepath.Join(append([]string{root}, names...)...)
+	if path == root || !within(root, path) {
+		return "", fmt.Errorf("path %q is outside %s", path, root)
+	}
+
+	// A symlink under root could still lead outside it, so resolve the
+	// deepest part of the path that exists
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return path, nil
+	}
+	for existing := path; existing != root; existing = filepath.Dir(existing) {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err != nil {
+			continue
+		}
+		if !within(resolvedRoot, resolved) {
+			return "", fmt.Errorf("path %q resolves outside %s", path, root)
+		}
+		break
+	}
+	return path, nil
+}
+
+// within reports whether path is root or inside it
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
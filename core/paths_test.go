@@ -0,0 +1,227 @@
+package core
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+func TestValidFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"data.json", true},
+		{"summarize-gpt-4o.md", true},
+		{"20260101-000000-aaaaaaaa", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{".hidden", false},
+		{"../data.json", false},
+		{"runs/x.json", false},
+		{`runs\x.json`, false},
+		{"/etc/passwd", false},
+		{"a\x00b", false},
+		{strings.Repeat("a", 255), true},
+		{strings.Repeat("a", 256), false},
+	}
+	for _, tt := range tests {
+		if got := ValidFileName(tt.name); got != tt.want {
+			t.Errorf("ValidFileName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSafeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"summarize", "summarize"},
+		{"gpt-4o", "gpt-4o"},
+		{"llama3:8b", "llama3_8b"},
+		{"../../etc/passwd", "_.._etc_passwd"},
+		{"..", "_"},
+		{"/abs", "_abs"},
+		{"a\x00b", "a_b"},
+		{"", "_"},
+	}
+	for _, tt := range tests {
+		got := SafeFileName(tt.name)
+		if got != tt.want {
+			t.Errorf("SafeFileName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if !ValidFileName(got) {
+			t.Errorf("SafeFileName(%q) = %q, which ValidFileName rejects", tt.name, got)
+		}
+	}
+	if got := SafeFileName(strings.Repeat("a", 300)); len(got) != 200 {
+		t.Errorf("SafeFileName of 300 characters has length %d, want 200", len(got))
+	}
+}
+
+func TestDataPath(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "videos")
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dQw4w9WgXcQ"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "dQw4w9WgXcQ"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		names []string
+		ok    bool
+	}{
+		{[]string{"dQw4w9WgXcQ"}, true},
+		{[]string{"dQw4w9WgXcQ", "data.json"}, true},
+		{[]string{"dQw4w9WgXcQ", "runs", "20260101-000000-aaaaaaaa.json"}, true},
+		{[]string{"upload-0123456789abcdef", "chats", "x.json"}, true},
+		// A symlink that stays inside the data dir is fine
+		{[]string{"alias", "data.json"}, true},
+		{nil, false},
+		{[]string{""}, false},
+		{[]string{".."}, false},
+		{[]string{"..", "secret.md"}, false},
+		{[]string{"../secret.md"}, false},
+		{[]string{"dQw4w9WgXcQ", ".."}, false},
+		{[]string{"dQw4w9WgXcQ", "../../secret.md"}, false},
+		{[]string{"/etc/passwd"}, false},
+		{[]string{outside}, false},
+		{[]string{"dQw4w9WgXcQ", "a\x00b.md"}, false},
+		{[]string{strings.Repeat("a", 256)}, false},
+		// Symlinks leading outside the data dir are rejected whether the
+		// final file exists or not
+		{[]string{"linked"}, false},
+		{[]string{"linked", "data.json"}, false},
+		{[]string{"linked", "runs", "x.json"}, false},
+	}
+	for _, tt := range tests {
+		path, err := dataPath(root, tt.names...)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("dataPath(%q) failed: %v", tt.names, err)
+				continue
+			}
+			if want := filepath.Join(append([]string{root}, tt.names...)...); path != want {
+				t.Errorf("dataPath(%q) = %q, want %q", tt.names, path, want)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("dataPath(%q) = %q, want an error", tt.names, path)
+		}
+	}
+}
+
+func TestDataPathUncleanRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "data") + "/../data/./videos/"
+	path, err := dataPath(root, "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("dataPath failed: %v", err)
+	}
+	if want := filepath.Join(dir, "data", "videos", "dQw4w9WgXcQ"); path != want {
+		t.Errorf("dataPath = %q, want %q", path, want)
+	}
+	if _, err := dataPath(root, ".."); err == nil {
+		t.Error("dataPath(..) under an unclean root succeeded")
+	}
+}
+
+func TestValidVideoID(t *testing.T) {
+	p := NewProcessor(slog.New(slog.NewTextHandler(io.Discard, nil)), t.TempDir(), yt.NewYT(""))
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"dQw4w9WgXcQ", true},
+		{"a-b_c-d_e-f", true},
+		{"dQw4w9WgXc", false},
+		{"dQw4w9WgXcQQ", false},
+		{"dQw4w9WgX.Q", false},
+		{"../../etc/p", false},
+		{"dQw4w9WgXc\x00", false},
+		{"upload-0123456789abcdef", true},
+		{"upload-0123456789ABCDEF", false},
+		{"upload-0123456789abcde", false},
+		{"upload-0123456789abcdef0", false},
+		{"upload-../../../../etc/", false},
+		{"upload-0123456789abcdef/..", false},
+		{"", false},
+		{strings.Repeat("a", 300), false},
+	}
+	for _, tt := range tests {
+		if got := p.ValidVideoID(tt.id); got != tt.want {
+			t.Errorf("ValidVideoID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	tests := []struct {
+		pattern string
+		model   string
+		want    string
+	}{
+		{"summarize", "gpt-4o", "summarize-gpt-4o.md"},
+		{"summarize", "llama3:8b", "summarize-llama3_8b.md"},
+		{"../../x", "m", "_.._x-m.md"},
+		{"", "", "_-_.md"},
+	}
+	for _, tt := range tests {
+		got := OutputName(tt.pattern, tt.model)
+		if got != tt.want {
+			t.Errorf("OutputName(%q, %q) = %q, want %q", tt.pattern, tt.model, got, tt.want)
+		}
+		if err := validOutputName(got); err != nil {
+			t.Errorf("OutputName(%q, %q) gave an invalid name: %v", tt.pattern, tt.model, err)
+		}
+	}
+}
+
+func TestStoresRejectUnsafeNames(t *testing.T) {
+	sqliteStore, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "fabric.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteStore.Close()
+	dataDir := t.TempDir()
+	stores := map[string]Store{"fs": NewFSStore(dataDir), "sqlite": sqliteStore}
+
+	for name, store := range stores {
+		for _, output := range []string{"../secret.md", "a/b.md", ".hidden.md", "data.json", ""} {
+			if err := store.SaveOutput("dQw4w9WgXcQ", output, "x"); err == nil {
+				t.Errorf("%s: SaveOutput(%q) succeeded", name, output)
+			}
+			if _, err := store.LoadOutput("dQw4w9WgXcQ", output); !os.IsNotExist(err) {
+				t.Errorf("%s: LoadOutput(%q) = %v, want not exist", name, output, err)
+			}
+		}
+		if err := store.SaveOutput("../escape", "x.md", "x"); err == nil {
+			t.Errorf("%s: SaveOutput under ../escape succeeded", name)
+		}
+		for _, run := range []Run{
+			{ID: "../../run", VideoID: "dQw4w9WgXcQ"},
+			{ID: "run*", VideoID: "dQw4w9WgXcQ"},
+			{ID: "run", VideoID: "../x"},
+		} {
+			if err := store.SaveRun(run, ""); err == nil {
+				t.Errorf("%s: SaveRun(%q, %q) succeeded", name, run.VideoID, run.ID)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "escape")); !os.IsNotExist(err) {
+		t.Errorf("SaveOutput wrote outside the videos dir")
+	}
+}
@@ -0,0 +1,315 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JobPipeline is the job kind running a pipeline over a video
+const JobPipeline = "pipeline"
+
+// PipelineInputTranscript makes a pipeline step read the video transcript instead of the previous step's output
+const PipelineInputTranscript = "transcript"
+
+var pipelineNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Pipeline is a named, reusable chain of pattern runs
+type Pipeline struct {
+	Name  string         `json:"name"`
+	Steps []PipelineStep `json:"steps"`
+}
+
+// PipelineStep runs one pattern. Its input is the previous step's output,
+// or the transcript for the first step and for steps with Input set to
+// PipelineInputTranscript.
+type PipelineStep struct {
+	Pattern string `json:"pattern"`
+	Model   string `json:"model"`
+	Input   string `json:"input,omitempty"`
+}
+
+// String formats the step the way ParsePipelineSteps reads it
+func (s PipelineStep) String() string {
+	if s.Input == PipelineInputTranscript {
+		return s.Pattern + " " + s.Model + " " + PipelineInputTranscript
+	}
+	return s.Pattern + " " + s.Model
+}
+
+// PipelineRun records one run of a pipeline over a video
+type PipelineRun struct {
+	ID         string               `json:"id"`
+	Pipeline   string               `json:"pipeline"`
+	VideoID    string               `json:"video_id"`
+	Steps      []PipelineStepResult `json:"steps"`
+	Error      string               `json:"error,omitempty"`
+	StartedAt  time.Time            `json:"started_at"`
+	FinishedAt time.Time            `json:"finished_at"`
+}
+
+// PipelineStepResult is the outcome of one step of a pipeline run
+type PipelineStepResult struct {
+	PipelineStep
+	// RunID identifies the run recorded for the step
+	RunID string `json:"run_id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ParsePipelineSteps parses one step per line as "pattern [model] [transcript]"
+func ParsePipelineSteps(text string) ([]PipelineStep, error) {
+	var steps []PipelineStep
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 || (len(fields) == 3 && fields[2] != PipelineInputTranscript) {
+			return nil, fmt.Errorf("line %d: expected \"pattern [model] [transcript]\"", i+1)
+		}
+		step := PipelineStep{Pattern: fields[0], Model: "default"}
+		if len(fields) > 1 {
+			step.Model = fields[1]
+		}
+		if len(fields) > 2 {
+			step.Input = PipelineInputTranscript
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("a pipeline needs at least one step")
+	}
+	return steps, nil
+}
+
+// ValidatePipelineName checks a pipeline name is usable as a file name
+func ValidatePipelineName(name string) error {
+	if !pipelineNameRegex.MatchString(name) {
+		return fmt.Errorf("pipeline names may only contain letters, digits, '-' and '_'")
+	}
+	return nil
+}
+
+// SavePipeline stores a pipeline definition
+func (p *Processor) SavePipeline(pipeline Pipeline) error {
+	if err := ValidatePipelineName(pipeline.Name); err != nil {
+		return err
+	}
+	if len(pipeline.Steps) == 0 {
+		return fmt.Errorf("a pipeline needs at least one step")
+	}
+	if err := os.MkdirAll(p.pipelinesDir, 0755); err != nil {
+		return err
+	}
+	pipelineJSON, err := json.Marshal(pipeline)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(p.pipelinesDir, pipeline.Name+".json"), pipelineJSON, 0644)
+}
+
+func (p *Processor) LoadPipeline(name string) (*Pipeline, error) {
+	if err := ValidatePipelineName(name); err != nil {
+		return nil, err
+	}
+	pipelineJSON, err := os.ReadFile(filepath.Join(p.pipelinesDir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var pipeline Pipeline
+	if err := json.Unmarshal(pipelineJSON, &pipeline); err != nil {
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// LoadPipelines loads all pipeline definitions ordered by name
+func (p *Processor) LoadPipelines() ([]Pipeline, error) {
+	files, err := os.ReadDir(p.pipelinesDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pipelines []Pipeline
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		pipeline, err := p.LoadPipeline(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pipeline %s: %v", file.Name(), err)
+		}
+		pipelines = append(pipelines, *pipeline)
+	}
+	sort.Slice(pipelines, func(i, j int) bool {
+		return pipelines[i].Name < pipelines[j].Name
+	})
+	return pipelines, nil
+}
+
+func (p *Processor) DeletePipeline(name string) error {
+	if err := ValidatePipelineName(name); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(p.pipelinesDir, name+".json"))
+}
+
+// EnqueuePipeline queues a job running a saved pipeline over a video
+func (p *Processor) EnqueuePipeline(videoID string, name string) (Job, error) {
+	if _, err := p.LoadPipeline(name); err != nil {
+		return Job{}, fmt.Errorf("failed to load pipeline: %v", err)
+	}
+	description := fmt.Sprintf("Run pipeline %s on %s", name, videoID)
+	return p.jobs.Enqueue(JobPipeline, description, map[string]string{
+		"videoID":  videoID,
+		"pipeline": name,
+	})
+}
+
+func (p *Processor) runPipelineJob(ctx context.Context, job Job, progress func(string)) (string, error) {
+	videoID := job.Params["videoID"]
+	pipeline, err := p.LoadPipeline(job.Params["pipeline"])
+	if err != nil {
+		return "", fmt.Errorf("failed to load pipeline: %v", err)
+	}
+	run, err := p.RunPipeline(ctx, videoID, *pipeline, progress)
+	if run == nil {
+		return "", err
+	}
+	return fmt.Sprintf("/videos/%s/pipelines/%s", videoID, run.ID), err
+}
+
+// RunPipeline runs each step of a pipeline in order, recording every step
+// as a regular run and the pipeline run alongside the video. The pipeline
+// run is saved even when a step fails, so partial results stay reachable.
+func (p *Processor) RunPipeline(ctx context.Context, videoID string, pipeline Pipeline, onChunk func(string)) (*PipelineRun, error) {
+	p.logger.Info("Running pipeline", "videoID", videoID, "pipeline", pipeline.Name)
+	video, err := p.store.LoadVideo(videoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load video: %v", err)
+	}
+	if video == nil {
+		return nil, fmt.Errorf("video %s not found", videoID)
+	}
+	runID, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	run := &PipelineRun{
+		ID:        runID,
+		Pipeline:  pipeline.Name,
+		VideoID:   videoID,
+		StartedAt: time.Now(),
+	}
+	previous := ""
+	for i, step := range pipeline.Steps {
+		if onChunk != nil {
+			onChunk(fmt.Sprintf("\n## Step %d: %s\n\n", i+1, step.Pattern))
+		}
+		result := PipelineStepResult{PipelineStep: step}
+
+		fromTranscript := i == 0 || step.Input == PipelineInputTranscript
+		input := previous
+		if fromTranscript {
+			input = video.Transcript
+		}
+		stepRun, output, err := p.recordRun(ctx, videoID, step.Pattern, step.Model, input, func(ctx context.Context, stepRun *Run) (string, error) {
+			if fromTranscript {
+				return p.runPattern(ctx, stepRun, *video, onChunk)
+			}
+			return p.backend.RunPattern(ctx, previous, step.Pattern, step.Model, onChunk)
+		})
+		if stepRun != nil {
+			result.RunID = stepRun.ID
+		}
+		if err != nil {
+			result.Error = err.Error()
+			run.Steps = append(run.Steps, result)
+			run.Error = fmt.Sprintf("step %d (%s) failed: %v", i+1, step.Pattern, err)
+			break
+		}
+		run.Steps = append(run.Steps, result)
+		previous = output
+	}
+	run.FinishedAt = time.Now()
+
+	if err := SavePipelineRun(*run, p.filesDir); err != nil {
+		return nil, fmt.Errorf("failed to save pipeline run: %v", err)
+	}
+	if run.Error != "" {
+		return run, fmt.Errorf("%s", run.Error)
+	}
+	return run, nil
+}
+
+func SavePipelineRun(run PipelineRun, dataDir string) error {
+	path, err := dataPath(dataDir, run.VideoID, "pipelines", run.ID+".json")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	runJSON, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, runJSON, 0644)
+}
+
+func LoadPipelineRun(videoID string, runID string, dataDir string) (*PipelineRun, error) {
+	path, err := dataPath(dataDir, videoID, "pipelines", runID+".json")
+	if err != nil {
+		return nil, err
+	}
+	runJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run PipelineRun
+	if err := json.Unmarshal(runJSON, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// LoadPipelineRuns loads a video's pipeline runs, newest first
+func LoadPipelineRuns(videoID string, dataDir string) ([]PipelineRun, error) {
+	runsDir, err := dataPath(dataDir, videoID, "pipelines")
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(runsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []PipelineRun
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		run, err := LoadPipelineRun(videoID, strings.TrimSuffix(file.Name(), ".json"), dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pipeline run %s: %v", file.Name(), err)
+		}
+		runs = append(runs, *run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs, nil
+}
@@ -1,60 +1,337 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"fabric-agents/yt"
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
+	"time"
 )
 
 type Processor struct {
-	logger   *slog.Logger
-	filesDir string
-	yt       *yt.YT
+	logger         *slog.Logger
+	filesDir       string
+	pipelinesDir   string
+	synthesesDir   string
+	sources        []Source
+	jobs           *JobQueue
+	backend        LLMBackend
+	backendInfo    *backendInfo
+	providers      *providerLimiter
+	store          Store
+	search         *SearchIndex
+	semantic       *SemanticIndex
+	embeddingsDir  string
+	runTimeout     time.Duration
+	maxInputTokens int
+	reducePattern  string
 }
 
-func NewProcessor(logger *slog.Logger, filesDir string, yt *yt.YT) *Processor {
-	return &Processor{logger: logger, filesDir: filesDir, yt: yt}
+// Job kinds run by the processor
+const (
+	JobFetch   = "fetch"
+	JobProcess = "process"
+)
+
+// NewProcessor creates a processor storing its data under dataDir that
+// fetches links from the given sources, tried in order
+func NewProcessor(logger *slog.Logger, dataDir string, sources ...Source) *Processor {
+	return &Processor{
+		logger:        logger,
+		filesDir:      filepath.Join(dataDir, "videos"),
+		pipelinesDir:  filepath.Join(dataDir, "pipelines"),
+		synthesesDir:  filepath.Join(dataDir, "syntheses"),
+		embeddingsDir: filepath.Join(dataDir, "embeddings"),
+		sources:       sources,
+		store:         NewFSStore(dataDir),
+		backend:       ExecBackend{},
+		backendInfo:   &backendInfo{},
+		search:        NewSearchIndex(),
+	}
+}
+
+// SetStore sets where videos, runs, collections and jobs are kept. The
+// default keeps them as files under the data directory.
+func (p *Processor) SetStore(store Store) {
+	p.store = store
+}
+
+// Store returns where videos, runs, collections and jobs are kept
+func (p *Processor) Store() Store {
+	return p.store
+}
+
+// SetBackend sets the backend patterns are run on. The default runs the fabric binary.
+func (p *Processor) SetBackend(backend LLMBackend) {
+	p.backend = backend
+	p.backendInfo = &backendInfo{}
+}
+
+// ListPatterns lists the patterns available on the backend
+func (p *Processor) ListPatterns(ctx context.Context) ([]string, error) {
+	return p.backend.ListPatterns(ctx)
+}
+
+// ListModels lists the models available on the backend
+func (p *Processor) ListModels(ctx context.Context) ([]Model, error) {
+	return p.backend.ListModels(ctx)
+}
+
+// SetRunTimeout limits how long a single pattern run may take. Zero means no limit.
+func (p *Processor) SetRunTimeout(timeout time.Duration) {
+	p.runTimeout = timeout
+}
+
+// RegisterJobs registers the processor's job kinds on the queue so fetching
+// and processing can run in the background through EnqueueFetch, EnqueueProcess,
+// EnqueuePipeline, EnqueueFanOut and EnqueueSynthesis
+func (p *Processor) RegisterJobs(q *JobQueue) {
+	p.jobs = q
+	q.Register(JobFetch, p.runFetchJob)
+	q.Register(JobProcess, p.runProcessJob)
+	q.Register(JobPipeline, p.runPipelineJob)
+	q.Register(JobFanOut, p.runFanOutJob)
+	q.Register(JobSynthesis, p.runSynthesisJob)
+	q.Register(JobChat, p.runChatJob)
+}
+
+// EnqueueFetch queues a job fetching the video or playlist behind a link
+func (p *Processor) EnqueueFetch(link string) (Job, error) {
+	return p.jobs.Enqueue(JobFetch, "Fetch "+link, map[string]string{"link": link})
+}
+
+// EnqueueProcess queues a job running a pattern over a video's transcript
+func (p *Processor) EnqueueProcess(videoID string, model string, pattern string) (Job, error) {
+	description := fmt.Sprintf("Run %s with %s on %s", pattern, model, videoID)
+	return p.jobs.Enqueue(JobProcess, description, map[string]string{
+		"videoID": videoID,
+		"model":   model,
+		"pattern": pattern,
+	})
+}
+
+// runFetchJob fetches a single video, or expands a playlist into one fetch job per member
+func (p *Processor) runFetchJob(ctx context.Context, job Job, progress func(string)) (string, error) {
+	link := job.Params["link"]
+	links, err := p.ExpandLink(link)
+	if err != nil {
+		return "", err
+	}
+	if len(links) == 1 && links[0] == link {
+		videoID, err := p.FetchVideo(link)
+		if err != nil {
+			return "", err
+		}
+		return "/videos/" + videoID, nil
+	}
+
+	for _, memberLink := range links {
+		if _, err := p.EnqueueFetch(memberLink); err != nil {
+			return "", err
+		}
+	}
+	return "/collections", nil
+}
+
+func (p *Processor) runProcessJob(ctx context.Context, job Job, progress func(string)) (string, error) {
+	videoID, model, pattern := job.Params["videoID"], job.Params["model"], job.Params["pattern"]
+	run, _, err := p.ProcessVideo(ctx, videoID, model, pattern, progress)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/videos/%s/runs/%s", videoID, run.ID), nil
+}
+
+// sourceForLink returns the first source that recognises the link along with the video ID it extracted
+func (p *Processor) sourceForLink(link string) (Source, string) {
+	for _, source := range p.sources {
+		if videoID := source.GetVideoID(link); videoID != "" {
+			return source, videoID
+		}
+	}
+	return nil, ""
+}
+
+// sourceForVideo returns the source a stored video was fetched from
+func (p *Processor) sourceForVideo(video *yt.Video) Source {
+	name := video.Source
+	if name == "" {
+		// Videos saved before sources were recorded all came from YouTube
+		name = yt.SourceName
+	}
+	for _, source := range p.sources {
+		if source.Name() == name {
+			return source
+		}
+	}
+	return nil
+}
+
+// ExpandLink turns a submitted link into the video links it stands for.
+// Playlist links are fetched, recorded as a collection and expanded into
+// their member videos; any other link is returned as is.
+func (p *Processor) ExpandLink(link string) ([]string, error) {
+	for _, source := range p.sources {
+		playlistSource, ok := source.(PlaylistSource)
+		if !ok || playlistSource.GetPlaylistID(link) == "" {
+			continue
+		}
+
+		p.logger.Info("Expanding playlist", "link", link)
+		playlist, err := playlistSource.GetPlaylist(link)
+		if err != nil {
+			if videoID := source.GetVideoID(link); videoID != "" {
+				// Watch links for mixes and other unlisted playlists still name a single video
+				p.logger.Warn("Failed to expand playlist, using the video alone", "link", link, "error", err)
+				return []string{link}, nil
+			}
+			return nil, fmt.Errorf("failed to expand playlist: %v", err)
+		}
+
+		collection := Collection{
+			ID:        playlist.ID,
+			Title:     playlist.Title,
+			Kind:      "playlist",
+			Source:    source.Name(),
+			URL:       playlist.URL,
+			VideoIDs:  playlist.VideoIDs,
+			UpdatedAt: time.Now(),
+		}
+		if err := p.store.SaveCollection(collection); err != nil {
+			return nil, fmt.Errorf("failed to save collection: %v", err)
+		}
+
+		links := make([]string, 0, len(playlist.VideoIDs))
+		for _, videoID := range playlist.VideoIDs {
+			links = append(links, source.VideoURL(videoID))
+		}
+		return links, nil
+	}
+	return []string{link}, nil
+}
+
+// LoadCollections returns the recorded collections
+func (p *Processor) LoadCollections() ([]Collection, error) {
+	return p.store.LoadCollections()
+}
+
+// LoadCollection returns a recorded collection
+func (p *Processor) LoadCollection(collectionID string) (*Collection, error) {
+	return p.store.LoadCollection(collectionID)
 }
 
 // FetchVideo fetches a video and returns the video directory
 func (p *Processor) FetchVideo(videoLink string) (string, error) {
 	p.logger.Info("Fetching video", "link", videoLink)
-	videoID := p.yt.GetVideoID(videoLink)
-	p.logger.Debug("Video ID", "videoID", videoID)
-
-	os.MkdirAll(filepath.Join(p.filesDir, videoID), 0755)
+	source, videoID := p.sourceForLink(videoLink)
+	if source == nil {
+		return "", fmt.Errorf("unsupported video link: %s", videoLink)
+	}
+	p.logger.Debug("Video ID", "videoID", videoID, "source", source.Name())
+	if !source.ValidVideoID(videoID) {
+		return "", fmt.Errorf("invalid %s video ID %q", source.Name(), videoID)
+	}
 
-	dataPath := filepath.Join(p.filesDir, videoID, "data.json")
-	if _, err := os.Stat(dataPath); err == nil {
-		// Transcript already exists, return the existing videoDir
+	existing, err := p.store.LoadVideo(videoID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load video: %v", err)
+	}
+	if existing != nil {
+		// Transcript already exists
 		return videoID, nil
 	}
 
-	video, err := p.yt.GetVideoInfo(videoLink)
+	video, err := source.GetVideoInfo(videoLink)
 	if err != nil {
 		p.logger.Error("Failed to get video info", "error", err)
 		return "", fmt.Errorf("failed to get video info: %v", err)
 	}
+	if video.Source == "" {
+		video.Source = source.Name()
+	}
 
-	SaveVideo(*video, p.filesDir)
+	if err := p.store.SaveVideo(*video); err != nil {
+		return "", fmt.Errorf("failed to save video: %v", err)
+	}
+	p.indexVideo(video.ID)
 	return video.ID, nil
 }
 
-func (p *Processor) ProcessVideo(videoID string, model string, pattern string) (string, yt.Video, error) {
+// ProcessVideo runs a pattern over a video's transcript and records the run
+// along with its output. If onChunk is not nil it receives the output as it
+// is generated. The run is stopped when ctx is cancelled or the processor's
+// run timeout passes.
+func (p *Processor) ProcessVideo(ctx context.Context, videoID string, model string, pattern string, onChunk func(string)) (*Run, string, error) {
 	p.logger.Info("Processing video", "videoID", videoID, "model", model, "pattern", pattern)
-	video, err := LoadVideo(videoID, p.filesDir)
+	video, err := p.store.LoadVideo(videoID)
 	if err != nil {
-		return "", yt.Video{}, fmt.Errorf("failed to load video: %v", err)
+		return nil, "", fmt.Errorf("failed to load video: %v", err)
+	}
+	if video == nil {
+		return nil, "", fmt.Errorf("video %s not found", videoID)
 	}
 
-	output, err := RunFabric(video.Transcript, pattern, model)
+	run, output, err := p.recordRun(ctx, videoID, pattern, model, video.Transcript, func(ctx context.Context, run *Run) (string, error) {
+		return p.runPattern(ctx, run, *video, onChunk)
+	})
 	if err != nil {
 		p.logger.Error("Failed to run fabric", "error", err)
-		return "", yt.Video{}, fmt.Errorf("failed to run fabric: %v", err)
+		return run, "", fmt.Errorf("failed to run fabric: %v", err)
+	}
+	return run, output, nil
+}
+
+// withRunTimeout calls run with ctx limited to the processor's run timeout
+func (p *Processor) withRunTimeout(ctx context.Context, run func(ctx context.Context) (string, error)) (string, error) {
+	if p.runTimeout <= 0 {
+		return run(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.runTimeout)
+	defer cancel()
+	output, err := run(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("timed out after %s", p.runTimeout)
+	}
+	return output, err
+}
+
+// RefetchTranscript replaces a video's transcript with the caption track of
+// exactly the given language and kind, as picked from the video's tracks
+func (p *Processor) RefetchTranscript(videoID string, language string, kind string) (*yt.Video, error) {
+	p.logger.Info("Refetching transcript", "videoID", videoID, "language", language, "kind", kind)
+	video, err := p.store.LoadVideo(videoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load video: %v", err)
+	}
+	if video == nil {
+		return nil, fmt.Errorf("video %s not found", videoID)
+	}
+
+	source, ok := p.sourceForVideo(video).(CaptionSource)
+	if !ok {
+		return nil, fmt.Errorf("video %s has no selectable caption tracks", videoID)
+	}
+	link := video.URL
+	if link == "" {
+		link = source.VideoURL(videoID)
 	}
 
-	SaveVideoFabricOutput(videoID, output, pattern, model, p.filesDir)
-	return output, *video, nil
+	prefs := []yt.CaptionPreference{{Kind: kind, Language: language, Exact: true}}
+	fetched, err := source.GetVideoInfoWithCaptions(link, prefs)
+	if err != nil {
+		p.logger.Error("Failed to refetch transcript", "error", err)
+		return nil, fmt.Errorf("failed to refetch transcript: %v", err)
+	}
+
+	video.Transcript = fetched.Transcript
+	video.Segments = fetched.Segments
+	video.CaptionTrack = fetched.CaptionTrack
+	video.CaptionTracks = fetched.CaptionTracks
+	if err := p.store.SaveVideo(*video); err != nil {
+		return nil, fmt.Errorf("failed to save video: %v", err)
+	}
+	p.indexVideo(videoID)
+	return video, nil
 }
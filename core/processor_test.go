@@ -0,0 +1,98 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+func TestFetchVideo(t *testing.T) {
+	source := &stubSource{
+		videos: map[string]yt.Video{
+			"aaaaaaaaaa1": {ID: "aaaaaaaaaa1", Title: "First", Transcript: "hello"},
+		},
+		failures: map[string]error{"bbbbbbbbbb2": errors.New("private video")},
+	}
+	p, _ := newTestProcessor(t, source)
+
+	videoID, err := p.FetchVideo("stub://video/aaaaaaaaaa1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if videoID != "aaaaaaaaaa1" {
+		t.Errorf("FetchVideo = %q, want aaaaaaaaaa1", videoID)
+	}
+	video, err := p.Store().LoadVideo(videoID)
+	if err != nil || video == nil {
+		t.Fatalf("fetched video not saved: %v", err)
+	}
+	if video.Source != "stub" || video.Transcript != "hello" {
+		t.Errorf("saved video has source %q transcript %q", video.Source, video.Transcript)
+	}
+
+	// Stored videos are not fetched again
+	if _, err := p.FetchVideo("stub://video/aaaaaaaaaa1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(source.fetched) != 1 {
+		t.Errorf("fetched %v, want the stored video reused", source.fetched)
+	}
+
+	tests := []struct {
+		name    string
+		link    string
+		fetches bool
+	}{
+		{"unsupported", "https://example.com/watch", false},
+		{"traversal", "stub://video/../../etc/pw", false},
+		{"failed fetch", "stub://video/bbbbbbbbbb2", true},
+		{"unknown video", "stub://video/ccccccccccc", true},
+	}
+	for _, tt := range tests {
+		source.fetched = nil
+		if _, err := p.FetchVideo(tt.link); err == nil {
+			t.Errorf("%s: FetchVideo(%q) succeeded", tt.name, tt.link)
+		}
+		if fetched := len(source.fetched) > 0; fetched != tt.fetches {
+			t.Errorf("%s: fetched = %v, want %v", tt.name, fetched, tt.fetches)
+		}
+	}
+	if video, _ := p.Store().LoadVideo("bbbbbbbbbb2"); video != nil {
+		t.Error("failed fetch saved a video")
+	}
+}
+
+func TestExpandLink(t *testing.T) {
+	source := &stubSource{
+		playlists: map[string]yt.Playlist{
+			"list1": {ID: "list1", Title: "A playlist", URL: "stub://playlist/list1", VideoIDs: []string{"aaaaaaaaaa1", "bbbbbbbbbb2"}},
+		},
+	}
+	p, _ := newTestProcessor(t, source)
+
+	links, err := p.ExpandLink("stub://playlist/list1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"stub://video/aaaaaaaaaa1", "stub://video/bbbbbbbbbb2"}; !reflect.DeepEqual(links, want) {
+		t.Errorf("ExpandLink = %v, want %v", links, want)
+	}
+	collection, err := p.LoadCollection("list1")
+	if err != nil || collection == nil {
+		t.Fatalf("playlist not recorded as a collection: %v", err)
+	}
+	if collection.Kind != "playlist" || collection.Source != "stub" || !reflect.DeepEqual(collection.VideoIDs, []string{"aaaaaaaaaa1", "bbbbbbbbbb2"}) {
+		t.Errorf("collection = %+v", collection)
+	}
+
+	links, err = p.ExpandLink("stub://video/aaaaaaaaaa1")
+	if err != nil || !reflect.DeepEqual(links, []string{"stub://video/aaaaaaaaaa1"}) {
+		t.Errorf("ExpandLink on a video = %v, %v; want the link unchanged", links, err)
+	}
+
+	if _, err := p.ExpandLink("stub://playlist/missing"); err == nil {
+		t.Error("ExpandLink on a missing playlist succeeded")
+	}
+}
@@ -0,0 +1,377 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RunStatus string
+
+const (
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+	RunCancelled RunStatus = "cancelled"
+)
+
+// Run records one pattern run over a video. Every run gets its own ID, so
+// running the same pattern and model again adds to the history instead of
+// replacing the earlier output. Runs are stored under the video's runs
+// directory as <id>.json, with the output next to it as <id>.md.
+type Run struct {
+	ID      string `json:"id"`
+	VideoID string `json:"video_id"`
+	Pattern string `json:"pattern"`
+	Model   string `json:"model"`
+	// Chunks is the number of transcript parts a map-reduce run was split into
+	Chunks int `json:"chunks,omitempty"`
+	RunRecord
+}
+
+// RunRecord is what runs and syntheses record about running a pattern: where
+// it ran, how large its input was and how it ended
+type RunRecord struct {
+	Provider string `json:"provider,omitempty"`
+	// Backend names the LLMBackend the run went through
+	Backend       string `json:"backend"`
+	FabricVersion string `json:"fabric_version,omitempty"`
+
+	InputBytes  int `json:"input_bytes"`
+	InputTokens int `json:"input_tokens"`
+
+	Status      RunStatus `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	OutputBytes int       `json:"output_bytes,omitempty"`
+	// SHA256 is the hex encoded hash of the output
+	SHA256 string `json:"sha256,omitempty"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Duration returns how long the run took
+func (r RunRecord) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond)
+}
+
+// ShortHash returns the first characters of the output hash for display
+func (r RunRecord) ShortHash() string {
+	if len(r.SHA256) < 12 {
+		return r.SHA256
+	}
+	return r.SHA256[:12]
+}
+
+// runFunc produces the output of a run. It may set run.Chunks.
+type runFunc func(ctx context.Context, run *Run) (string, error)
+
+// recordRun runs fn and saves a run record for it whether it succeeds or
+// not. The output is saved only on success.
+func (p *Processor) recordRun(ctx context.Context, videoID string, pattern string, model string, input string, fn runFunc) (*Run, string, error) {
+	runID, err := newJobID()
+	if err != nil {
+		return nil, "", err
+	}
+	run := &Run{
+		ID:      runID,
+		VideoID: videoID,
+		Pattern: pattern,
+		Model:   model,
+	}
+	output, runErr := p.execute(ctx, &run.RunRecord, model, input, func(ctx context.Context) (string, error) {
+		return fn(ctx, run)
+	})
+	if run.Status == "" {
+		return nil, "", runErr
+	}
+
+	if err := p.store.SaveRun(*run, output); err != nil {
+		return nil, "", fmt.Errorf("failed to save run: %v", err)
+	}
+	if run.Status == RunSucceeded {
+		p.indexVideo(videoID)
+	}
+	return run, output, runErr
+}
+
+// execute runs fn over input under the processor's run timeout and the
+// provider's concurrency limit, filling in record as it goes. When ctx ends
+// while waiting for the provider, fn does not run and record.Status is left
+// empty.
+func (p *Processor) execute(ctx context.Context, record *RunRecord, model string, input string, fn func(ctx context.Context) (string, error)) (string, error) {
+	record.Provider = p.providerFor(ctx, model)
+	record.Backend = p.backend.Name()
+	record.FabricVersion = p.backendVersion(ctx, p.backend)
+	record.InputBytes = len(input)
+	record.InputTokens = EstimateTokens(input)
+
+	// Waiting for the provider counts towards neither the run time nor its timeout
+	release, err := p.providers.acquire(ctx, record.Provider)
+	if err != nil {
+		return "", fmt.Errorf("stopped while waiting for a free %s slot: %v", record.Backend, err)
+	}
+	defer release()
+	record.StartedAt = time.Now()
+
+	ctx = withBackendUsed(ctx, func(backend LLMBackend) {
+		record.Backend = backend.Name()
+		record.FabricVersion = p.backendVersion(ctx, backend)
+	})
+	output, err := p.withRunTimeout(ctx, fn)
+	record.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		record.Status = RunSucceeded
+		record.OutputBytes = len(output)
+		hash := sha256.Sum256([]byte(output))
+		record.SHA256 = hex.EncodeToString(hash[:])
+	case ctx.Err() != nil:
+		record.Status = RunCancelled
+		record.Error = err.Error()
+	default:
+		record.Status = RunFailed
+		record.Error = err.Error()
+	}
+	return output, err
+}
+
+// backendInfoTTL is how long model providers and backend versions looked up
+// for run records are reused. The exec backend starts fabric for each lookup.
+const backendInfoTTL = 10 * time.Minute
+
+// backendInfo caches the model providers and backend versions recorded with
+// runs. Failed lookups are cached too, so an unreachable backend isn't asked
+// again on every run. The lock only guards the cache: lookups run without it
+// so one slow backend doesn't hold up every other run starting, and runs
+// missing the cache at the same time may each look up.
+type backendInfo struct {
+	mu          sync.Mutex
+	providers   map[string]string
+	providersAt time.Time
+	versions    map[string]cachedVersion
+}
+
+type cachedVersion struct {
+	version string
+	at      time.Time
+}
+
+// providerFor looks up the provider serving a model. Failures only leave the
+// provider out of the run record.
+func (p *Processor) providerFor(ctx context.Context, model string) string {
+	if model == "" || model == "default" {
+		return ""
+	}
+	info := p.backendInfo
+	info.mu.Lock()
+	if info.providers != nil && time.Since(info.providersAt) <= backendInfoTTL {
+		provider := info.providers[model]
+		info.mu.Unlock()
+		return provider
+	}
+	info.mu.Unlock()
+
+	models, err := p.backend.ListModels(ctx)
+	if err != nil {
+		p.logger.Warn("Failed to look up model providers", "model", model, "error", err)
+	}
+	providers := make(map[string]string, len(models))
+	for _, m := range models {
+		providers[m.Name] = m.Provider
+	}
+	info.mu.Lock()
+	info.providers = providers
+	info.providersAt = time.Now()
+	info.mu.Unlock()
+	return providers[model]
+}
+
+// backendVersion returns the fabric version behind a backend, if it reports one
+func (p *Processor) backendVersion(ctx context.Context, backend LLMBackend) string {
+	versioned, ok := backend.(VersionedBackend)
+	if !ok {
+		return ""
+	}
+	info := p.backendInfo
+	info.mu.Lock()
+	cached, ok := info.versions[backend.Name()]
+	info.mu.Unlock()
+	if ok && time.Since(cached.at) <= backendInfoTTL {
+		return cached.version
+	}
+
+	version, err := versioned.Version(ctx)
+	if err != nil {
+		p.logger.Warn("Failed to get backend version", "backend", backend.Name(), "error", err)
+	}
+	info.mu.Lock()
+	if info.versions == nil {
+		info.versions = make(map[string]cachedVersion)
+	}
+	info.versions[backend.Name()] = cachedVersion{version: version, at: time.Now()}
+	info.mu.Unlock()
+	return version
+}
+
+func runsDir(videoID string, dataDir string) (string, error) {
+	return dataPath(dataDir, videoID, "runs")
+}
+
+// runPath returns the path of a run's file with the given suffix
+func runPath(videoID string, runID string, suffix string, dataDir string) (string, error) {
+	if err := validRunID(videoID, runID); err != nil {
+		return "", err
+	}
+	return dataPath(dataDir, videoID, "runs", runID+suffix)
+}
+
+// SaveRun writes a run record, and its output when the run succeeded
+func SaveRun(run Run, output string, dataDir string) error {
+	path, err := runPath(run.VideoID, run.ID, ".json", dataDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if run.Status == RunSucceeded {
+		outputPath, err := runPath(run.VideoID, run.ID, ".md", dataDir)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(outputPath, []byte(output), 0644); err != nil {
+			return err
+		}
+	}
+	runJSON, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, runJSON, 0644)
+}
+
+// SaveRunChunk writes the output of one part of a map-reduce run
+func SaveRunChunk(videoID string, runID string, part int, output string, dataDir string) error {
+	path, err := runPath(videoID, runID, fmt.Sprintf(".chunk-%02d.md", part), dataDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(output), 0644)
+}
+
+func LoadRun(videoID string, runID string, dataDir string) (*Run, error) {
+	path, err := runPath(videoID, runID, ".json", dataDir)
+	if err != nil {
+		return nil, err
+	}
+	runJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(runJSON, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// LoadRunOutput returns the output of a successful run
+func LoadRunOutput(videoID string, runID string, dataDir string) (string, error) {
+	path, err := runPath(videoID, runID, ".md", dataDir)
+	if err != nil {
+		return "", err
+	}
+	output, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// LoadRunChunks returns the outputs of a map-reduce run's parts in order
+func LoadRunChunks(videoID string, runID string, dataDir string) ([]string, error) {
+	// runPath rejects run IDs holding glob characters
+	prefix, err := runPath(videoID, runID, ".chunk-", dataDir)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(prefix + "*.md")
+	if err != nil {
+		return nil, err
+	}
+	// Part numbers are zero padded to two digits only, so order by number
+	parts := make(map[string]int, len(paths))
+	for _, path := range paths {
+		part, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, prefix), ".md"))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected run part file %s", filepath.Base(path))
+		}
+		parts[path] = part
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return parts[paths[i]] < parts[paths[j]]
+	})
+	chunks := make([]string, 0, len(paths))
+	for _, path := range paths {
+		chunk, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, string(chunk))
+	}
+	return chunks, nil
+}
+
+// CorruptRun is a run record that could not be read. It is skipped when
+// listing runs and reported instead of failing the whole video.
+type CorruptRun struct {
+	ID    string
+	Error string
+}
+
+// LoadRuns loads a video's runs, newest first, skipping those whose record
+// can't be read
+func LoadRuns(videoID string, dataDir string) ([]Run, []CorruptRun, error) {
+	dir, err := runsDir(videoID, dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var runs []Run
+	var corrupt []CorruptRun
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		id := strings.TrimSuffix(file.Name(), ".json")
+		run, err := LoadRun(videoID, id, dataDir)
+		if err != nil {
+			corrupt = append(corrupt, CorruptRun{ID: id, Error: err.Error()})
+			continue
+		}
+		runs = append(runs, *run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs, corrupt, nil
+}
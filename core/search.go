@@ -0,0 +1,549 @@
+package core
+
+import (
+	"fabric-agents/yt"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Kinds of searchable documents
+const (
+	SearchTitle      = "title"
+	SearchTranscript = "transcript"
+	SearchOutput     = "output"
+	SearchSynthesis  = "synthesis"
+)
+
+// searchWindowSeconds is how much of a transcript one search document covers.
+// Windows keep nearby words together for multi-word queries while still
+// pointing at a precise timestamp.
+const searchWindowSeconds = 30
+
+// snippetRadius is roughly how many characters of context a snippet shows around its first match
+const snippetRadius = 80
+
+// searchDoc is one indexed piece of text
+type searchDoc struct {
+	id      string
+	kind    string
+	videoID string
+	// label describes where the text comes from, e.g. the pattern of an output
+	label string
+	link  string
+	// start is the offset in seconds of a transcript window
+	start  float64
+	text   string
+	length int
+}
+
+// SearchHit is one search result
+type SearchHit struct {
+	Kind    string
+	VideoID string
+	// Title is the video's title, or the synthesis title for syntheses
+	Title   string
+	Label   string
+	Link    string
+	Start   float64
+	Snippet []SnippetPart
+	Score   float64
+}
+
+// Timestamp formats the start of a transcript hit as m:ss or h:mm:ss
+func (h SearchHit) Timestamp() string {
+	return formatTimestamp(h.Start)
+}
+
+// formatTimestamp formats an offset in seconds as m:ss or h:mm:ss
+func formatTimestamp(seconds float64) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// StartSeconds returns the start of a transcript hit in whole seconds
+func (h SearchHit) StartSeconds() int {
+	return int(h.Start)
+}
+
+// SnippetPart is a piece of a snippet; Match marks the highlighted query terms
+type SnippetPart struct {
+	Text  string
+	Match bool
+}
+
+// SearchIndex is an in-memory inverted index over video titles, channels,
+// transcripts, run outputs and syntheses. It is built from the data
+// directory at startup and updated as videos, runs and syntheses change.
+type SearchIndex struct {
+	mu     sync.RWMutex
+	docs   map[string]*searchDoc
+	terms  map[string]map[string]int
+	titles map[string]string
+	// owned lists the documents belonging to each video or synthesis so they can be replaced together
+	owned map[string][]string
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		docs:   make(map[string]*searchDoc),
+		terms:  make(map[string]map[string]int),
+		titles: make(map[string]string),
+		owned:  make(map[string][]string),
+	}
+}
+
+// tokenize splits text into lower-cased words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// add indexes a document under an owner. Call with idx.mu held.
+func (idx *SearchIndex) add(owner string, doc *searchDoc) {
+	tokens := tokenize(doc.text)
+	if len(tokens) == 0 {
+		return
+	}
+	doc.length = len(tokens)
+	idx.docs[doc.id] = doc
+	idx.owned[owner] = append(idx.owned[owner], doc.id)
+	for _, token := range tokens {
+		postings, ok := idx.terms[token]
+		if !ok {
+			postings = make(map[string]int)
+			idx.terms[token] = postings
+		}
+		postings[doc.id]++
+	}
+}
+
+// remove drops every document of an owner. Call with idx.mu held.
+func (idx *SearchIndex) remove(owner string) {
+	for _, docID := range idx.owned[owner] {
+		doc, ok := idx.docs[docID]
+		if !ok {
+			continue
+		}
+		for _, token := range tokenize(doc.text) {
+			if postings, ok := idx.terms[token]; ok {
+				delete(postings, docID)
+				if len(postings) == 0 {
+					delete(idx.terms, token)
+				}
+			}
+		}
+		delete(idx.docs, docID)
+	}
+	delete(idx.owned, owner)
+	delete(idx.titles, owner)
+}
+
+// IndexedOutput is a generated output indexed along with its video
+type IndexedOutput struct {
+	// Key identifies the output within the video, e.g. a run ID or file name
+	Key   string
+	Label string
+	Link  string
+	Text  string
+}
+
+// IndexVideo replaces everything indexed for a video with its current title,
+// channel, transcript and outputs
+func (idx *SearchIndex) IndexVideo(video yt.Video, outputs []IndexedOutput) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(video.ID)
+	idx.titles[video.ID] = video.Title
+
+	videoLink := "/videos/" + video.ID
+	idx.add(video.ID, &searchDoc{
+		id:      video.ID + "/title",
+		kind:    SearchTitle,
+		videoID: video.ID,
+		label:   video.Channel,
+		link:    videoLink,
+		text:    video.Title + "\n" + video.Channel,
+	})
+
+	for i, window := range transcriptWindows(video) {
+		idx.add(video.ID, &searchDoc{
+			id:      fmt.Sprintf("%s/transcript/%d", video.ID, i),
+			kind:    SearchTranscript,
+			videoID: video.ID,
+			link:    fmt.Sprintf("%s?t=%d", videoLink, int(window.Start)),
+			start:   window.Start,
+			text:    window.Text,
+		})
+	}
+
+	for _, output := range outputs {
+		idx.add(video.ID, &searchDoc{
+			id:      video.ID + "/output/" + output.Key,
+			kind:    SearchOutput,
+			videoID: video.ID,
+			label:   output.Label,
+			link:    output.Link,
+			text:    output.Text,
+		})
+	}
+}
+
+// RemoveVideo drops a video from the index
+func (idx *SearchIndex) RemoveVideo(videoID string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(videoID)
+}
+
+// IndexSynthesis replaces the indexed output of a synthesis
+func (idx *SearchIndex) IndexSynthesis(synthesis Synthesis, output string) {
+	owner := "synthesis/" + synthesis.ID
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(owner)
+	idx.titles[owner] = synthesis.Title
+	idx.add(owner, &searchDoc{
+		id:    owner,
+		kind:  SearchSynthesis,
+		label: synthesis.Pattern + " · " + synthesis.Model,
+		link:  "/syntheses/" + synthesis.ID,
+		text:  synthesis.Title + "\n" + output,
+	})
+}
+
+// MatchingVideos returns the IDs of the videos whose title, channel,
+// transcript or an output contains every query term, as found by Search
+func (idx *SearchIndex) MatchingVideos(query string) map[string]bool {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	matched := make(map[string]bool)
+	for docID := range idx.terms[terms[0]] {
+		doc := idx.docs[docID]
+		if doc.kind == SearchSynthesis || matched[doc.videoID] {
+			continue
+		}
+		all := true
+		for _, term := range terms[1:] {
+			if _, ok := idx.terms[term][docID]; !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			matched[doc.videoID] = true
+		}
+	}
+	return matched
+}
+
+// Search returns up to limit documents containing every query term, best
+// matches first. Scores are BM25 with title matches boosted.
+func (idx *SearchIndex) Search(query string, limit int) []SearchHit {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Start from the rarest term so the candidate set is as small as possible
+	sort.Slice(terms, func(i, j int) bool {
+		return len(idx.terms[terms[i]]) < len(idx.terms[terms[j]])
+	})
+	candidates := idx.terms[terms[0]]
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	totalLength := 0
+	for _, doc := range idx.docs {
+		totalLength += doc.length
+	}
+	avgLength := float64(totalLength) / float64(len(idx.docs))
+	const k1, b = 1.2, 0.75
+
+	type scored struct {
+		doc   *searchDoc
+		score float64
+	}
+	var matches []scored
+	for docID := range candidates {
+		doc := idx.docs[docID]
+		score := 0.0
+		for _, term := range terms {
+			postings := idx.terms[term]
+			tf, ok := postings[docID]
+			if !ok {
+				score = -1
+				break
+			}
+			idf := math.Log(1 + (float64(len(idx.docs))-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+			score += idf * float64(tf) * (k1 + 1) / (float64(tf) + k1*(1-b+b*float64(doc.length)/avgLength))
+		}
+		if score < 0 {
+			continue
+		}
+		if doc.kind == SearchTitle {
+			score *= 2
+		}
+
+		matches = append(matches, scored{doc: doc, score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	// Snippets are only cut for the hits that are returned
+	hits := make([]SearchHit, 0, len(matches))
+	for _, match := range matches {
+		doc := match.doc
+		owner := doc.videoID
+		if doc.kind == SearchSynthesis {
+			owner = doc.id
+		}
+		hits = append(hits, SearchHit{
+			Kind:    doc.kind,
+			VideoID: doc.videoID,
+			Title:   idx.titles[owner],
+			Label:   doc.label,
+			Link:    doc.link,
+			Start:   doc.start,
+			Snippet: snippet(doc.text, terms),
+			Score:   match.score,
+		})
+	}
+	return hits
+}
+
+// transcriptWindows groups a video's segments into windows of about
+// searchWindowSeconds. Transcripts without segments are cut into windows of
+// at most maxEmbedChars, all starting at 0, and longer timed windows are split
+// the same way, so every window fits an embedding model's context.
+func transcriptWindows(video yt.Video) []Chunk {
+	if len(video.Segments) == 0 {
+		return ChunkText(video.Transcript, maxEmbedChars/4)
+	}
+	var windows []Chunk
+	var text strings.Builder
+	start := video.Segments[0].Start
+	for i, segment := range video.Segments {
+		if text.Len() > 0 && segment.Start-start >= searchWindowSeconds {
+			windows = append(windows, Chunk{Start: start, End: segment.Start, Text: text.String()})
+			text.Reset()
+			start = segment.Start
+		}
+		if text.Len() > 0 {
+			text.WriteString(" ")
+		}
+		text.WriteString(segment.Text)
+		if i == len(video.Segments)-1 {
+			windows = append(windows, Chunk{Start: start, End: segment.Start + segment.Duration, Text: text.String()})
+		}
+	}
+
+	var capped []Chunk
+	for _, window := range windows {
+		if len(window.Text) <= maxEmbedChars {
+			capped = append(capped, window)
+			continue
+		}
+		for _, piece := range ChunkText(window.Text, maxEmbedChars/4) {
+			piece.Start, piece.End = window.Start, window.End
+			capped = append(capped, piece)
+		}
+	}
+	return capped
+}
+
+// snippet cuts the text around the first query term and marks every term in it
+func snippet(text string, terms []string) []SnippetPart {
+	text = strings.Join(strings.Fields(text), " ")
+	wanted := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		wanted[term] = true
+	}
+
+	// Word boundaries as byte offsets, found the same way tokenize splits
+	type word struct{ start, end int }
+	var words []word
+	wordStart := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && wordStart < 0 {
+			wordStart = i
+		}
+		if !isWord && wordStart >= 0 {
+			words = append(words, word{wordStart, i})
+			wordStart = -1
+		}
+	}
+	if wordStart >= 0 {
+		words = append(words, word{wordStart, len(text)})
+	}
+
+	from, to := 0, len(text)
+	for _, w := range words {
+		if wanted[strings.ToLower(text[w.start:w.end])] {
+			from = strings.LastIndex(text[:max(0, w.start-snippetRadius)], " ") + 1
+			to = min(len(text), w.end+snippetRadius)
+			if i := strings.Index(text[to:], " "); i >= 0 {
+				to += i
+			} else {
+				to = len(text)
+			}
+			break
+		}
+	}
+	if from == 0 && to == len(text) && len(text) > 2*snippetRadius {
+		to = strings.LastIndex(text[:2*snippetRadius], " ")
+		if to <= 0 {
+			to = 2 * snippetRadius
+		}
+	}
+
+	var parts []SnippetPart
+	if from > 0 {
+		parts = append(parts, SnippetPart{Text: "… "})
+	}
+	last := from
+	for _, w := range words {
+		if w.start < from || w.end > to {
+			continue
+		}
+		if wanted[strings.ToLower(text[w.start:w.end])] {
+			if w.start > last {
+				parts = append(parts, SnippetPart{Text: text[last:w.start]})
+			}
+			parts = append(parts, SnippetPart{Text: text[w.start:w.end], Match: true})
+			last = w.end
+		}
+	}
+	if to > last {
+		parts = append(parts, SnippetPart{Text: text[last:to]})
+	}
+	if to < len(text) {
+		parts = append(parts, SnippetPart{Text: " …"})
+	}
+	return parts
+}
+
+// indexVideo reloads a video with its runs and outputs into the search
+// index. Failures are logged since the index only mirrors what is on disk.
+func (p *Processor) indexVideo(videoID string) {
+	video, err := p.store.LoadVideo(videoID)
+	if err != nil || video == nil {
+		p.logger.Warn("Failed to index video", "videoID", videoID, "error", err)
+		return
+	}
+	runs, _, err := p.store.LoadRuns(videoID)
+	if err != nil {
+		p.logger.Warn("Failed to load runs for indexing", "videoID", videoID, "error", err)
+	}
+	var outputs []IndexedOutput
+	for _, run := range runs {
+		if run.Status != RunSucceeded {
+			continue
+		}
+		if text, err := p.store.LoadRunOutput(videoID, run.ID); err == nil {
+			outputs = append(outputs, IndexedOutput{
+				Key:   run.ID,
+				Label: run.Pattern + " · " + run.Model,
+				Link:  fmt.Sprintf("/videos/%s/runs/%s", videoID, run.ID),
+				Text:  text,
+			})
+		}
+	}
+	// Outputs saved before runs were recorded
+	files, err := p.store.LoadOutputs(videoID)
+	if err != nil {
+		p.logger.Warn("Failed to list outputs for indexing", "videoID", videoID, "error", err)
+	}
+	for _, file := range files {
+		if text, err := p.store.LoadOutput(videoID, file); err == nil {
+			outputs = append(outputs, IndexedOutput{
+				Key:   file,
+				Label: strings.TrimSuffix(file, ".md"),
+				Link:  fmt.Sprintf("/videos/%s/%s", videoID, file),
+				Text:  text,
+			})
+		}
+	}
+	p.search.IndexVideo(*video, outputs)
+	p.embedVideo(*video, outputs)
+}
+
+// BuildSearchIndex indexes every stored video and synthesis. With semantic
+// search enabled, stored embeddings are loaded and anything missing from them
+// is embedded in the background.
+func (p *Processor) BuildSearchIndex() error {
+	if p.semantic != nil {
+		if err := p.semantic.Load(); err != nil {
+			return fmt.Errorf("failed to load embeddings: %v", err)
+		}
+	}
+	videos, corrupt, err := p.store.LoadVideos()
+	if err != nil {
+		return fmt.Errorf("failed to list videos: %v", err)
+	}
+	for _, video := range corrupt {
+		p.logger.Warn("Skipping corrupt video", "videoID", video.ID, "error", video.Error)
+	}
+	for _, video := range videos {
+		p.indexVideo(video.ID)
+	}
+	syntheses, err := p.LoadSyntheses()
+	if err != nil {
+		return fmt.Errorf("failed to load syntheses: %v", err)
+	}
+	for _, synthesis := range syntheses {
+		_, output, err := p.LoadSynthesis(synthesis.ID)
+		if err != nil {
+			p.logger.Warn("Failed to load synthesis for indexing", "synthesisID", synthesis.ID, "error", err)
+			continue
+		}
+		p.search.IndexSynthesis(synthesis, output)
+		p.embedSynthesis(synthesis, output)
+	}
+	p.logger.Info("Search index built", "videos", len(videos), "syntheses", len(syntheses))
+	return nil
+}
+
+// Search searches titles, channels, transcripts and outputs
+func (p *Processor) Search(query string, limit int) []SearchHit {
+	return p.search.Search(query, limit)
+}
+
+// DeleteVideo deletes a video with everything generated for it, including
+// the chats and pipeline runs kept next to it outside the store
+func (p *Processor) DeleteVideo(videoID string) error {
+	dir, err := dataPath(p.filesDir, videoID)
+	if err != nil {
+		return err
+	}
+	if err := p.store.DeleteVideo(videoID); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	p.search.RemoveVideo(videoID)
+	p.unembedVideo(videoID)
+	return nil
+}
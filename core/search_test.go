@@ -0,0 +1,85 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+func TestTranscriptWindowsFitEmbeddings(t *testing.T) {
+	sentence := "This transcript was saved before segments were recorded. "
+	long := strings.Repeat("word", 2000)
+	tests := []struct {
+		name     string
+		video    yt.Video
+		min, max int
+	}{
+		{"empty", yt.Video{Transcript: "  "}, 0, 0},
+		{"short plain", yt.Video{Transcript: sentence}, 1, 1},
+		{"long plain", yt.Video{Transcript: strings.Repeat(sentence, 500)}, 2, 1000},
+		{"plain single word", yt.Video{Transcript: long}, 2, 1000},
+		{"timed", yt.Video{Segments: []yt.Segment{
+			{Start: 0, Duration: 10, Text: "one"},
+			{Start: 10, Duration: 10, Text: "two"},
+			{Start: 40, Duration: 10, Text: "three"},
+		}}, 2, 2},
+		{"timed long segment", yt.Video{Segments: []yt.Segment{
+			{Start: 5, Duration: 10, Text: strings.Repeat(sentence, 100)},
+		}}, 2, 1000},
+	}
+	for _, tt := range tests {
+		windows := transcriptWindows(tt.video)
+		if len(windows) < tt.min || len(windows) > tt.max {
+			t.Errorf("%s: got %d windows, want %d to %d", tt.name, len(windows), tt.min, tt.max)
+		}
+		for i, window := range windows {
+			if len(window.Text) > maxEmbedChars {
+				t.Errorf("%s: window %d has %d characters, over %d", tt.name, i, len(window.Text), maxEmbedChars)
+			}
+		}
+	}
+
+	// Pieces of a long timed window keep its timing
+	windows := transcriptWindows(yt.Video{Segments: []yt.Segment{{Start: 5, Duration: 10, Text: strings.Repeat(sentence, 100)}}})
+	for _, window := range windows {
+		if window.Start != 5 || window.End != 15 {
+			t.Errorf("split window spans %v-%v, want 5-15", window.Start, window.End)
+		}
+	}
+}
+
+func TestSplitPassagesCap(t *testing.T) {
+	paragraph := strings.Repeat("A sentence of an output. ", 200)
+	text := "Intro.\n\n" + paragraph + "\n\n" + strings.Repeat("x", 5000) + "\n\nOutro."
+	passages := splitPassages(text)
+	if len(passages) < 4 {
+		t.Fatalf("got %d passages, want the long paragraphs split", len(passages))
+	}
+	if passages[0] != "Intro." || passages[len(passages)-1] != "Outro." {
+		t.Errorf("short paragraphs not kept whole: first %q, last %q", passages[0], passages[len(passages)-1])
+	}
+	for i, passage := range passages {
+		if len(passage) > maxEmbedChars {
+			t.Errorf("passage %d has %d characters, over %d", i, len(passage), maxEmbedChars)
+		}
+	}
+}
+
+func TestSplitWord(t *testing.T) {
+	tests := []struct {
+		word     string
+		maxChars int
+		want     []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"abcdefgh", 3, []string{"abc", "def", "gh"}},
+		{"ééé", 3, []string{"é", "é", "é"}},
+	}
+	for _, tt := range tests {
+		got := splitWord(tt.word, tt.maxChars)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("splitWord(%q, %d) = %q, want %q", tt.word, tt.maxChars, got, tt.want)
+		}
+	}
+}
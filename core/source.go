@@ -0,0 +1,24 @@
+package core
+
+import "fabric-agents/yt"
+
+// Source is somewhere videos and their transcripts can be fetched from.
+// The processor hands each link to the first source that recognises it.
+type Source interface {
+	// Name identifies the source and is recorded on every video it produces
+	Name() string
+	// GetVideoID returns the video ID for a link, or "" if the source does not handle it
+	GetVideoID(link string) string
+	// GetVideoInfo fetches the metadata and transcript for a link
+	GetVideoInfo(link string) (*yt.Video, error)
+	// VideoURL returns the canonical link for a video ID
+	VideoURL(videoID string) string
+	// ValidVideoID reports whether videoID fits the source's ID format
+	ValidVideoID(videoID string) bool
+}
+
+// CaptionSource is implemented by sources that offer several caption tracks per video
+type CaptionSource interface {
+	Source
+	GetVideoInfoWithCaptions(link string, prefs []yt.CaptionPreference) (*yt.Video, error)
+}
@@ -0,0 +1,337 @@
+package core
+
+import (
+	"fabric-agents/yt"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// VideoStore persists videos and the named outputs saved for them before
+// runs were recorded, such as summarize-gpt-4o.md
+type VideoStore interface {
+	// LoadVideos returns every video without its transcript, segments and
+	// comments, which listings don't need. Use LoadVideo for those. Videos
+	// that can't be read are skipped and returned as corrupt.
+	LoadVideos() ([]yt.Video, []CorruptVideo, error)
+	// LoadVideo returns nil without an error when the video doesn't exist
+	LoadVideo(videoID string) (*yt.Video, error)
+	SaveVideo(video yt.Video) error
+	// DeleteVideo deletes a video with its outputs and runs
+	DeleteVideo(videoID string) error
+
+	LoadOutputs(videoID string) ([]string, error)
+	LoadOutput(videoID string, name string) (string, error)
+	// SaveOutput fails for names that aren't plain .md file names, see OutputName
+	SaveOutput(videoID string, name string, output string) error
+}
+
+// RunStore persists pattern runs, their outputs and the outputs of their
+// map-reduce parts
+type RunStore interface {
+	// SaveRun saves a run record, and its output when the run succeeded
+	SaveRun(run Run, output string) error
+	SaveRunChunk(videoID string, runID string, part int, output string) error
+	LoadRun(videoID string, runID string) (*Run, error)
+	LoadRunOutput(videoID string, runID string) (string, error)
+	// LoadRunChunks returns the outputs of a run's parts in order
+	LoadRunChunks(videoID string, runID string) ([]string, error)
+	// LoadRuns returns a video's runs, newest first
+	LoadRuns(videoID string) ([]Run, []CorruptRun, error)
+}
+
+// CollectionStore persists collections, the named groups of videos such as
+// expanded playlists. A collection lists its videos; videos don't record the
+// collections they belong to.
+type CollectionStore interface {
+	SaveCollection(collection Collection) error
+	LoadCollection(collectionID string) (*Collection, error)
+	// LoadCollections returns all collections, most recently updated first
+	LoadCollections() ([]Collection, error)
+}
+
+// TagStore persists the tags videos are labelled with. Tags are normalized
+// with NormalizeTags and deleted with their video.
+type TagStore interface {
+	// SaveTags replaces the tags of a stored video
+	SaveTags(videoID string, tags []string) error
+	// LoadTags returns the tags of a video, sorted
+	LoadTags(videoID string) ([]string, error)
+	// LoadAllTags returns every tag in use with the IDs of the videos carrying it
+	LoadAllTags() (map[string][]string, error)
+}
+
+// JobStore persists background jobs
+type JobStore interface {
+	SaveJob(job Job) error
+	// LoadJobs returns all jobs, oldest first. Jobs that can't be read are
+	// skipped and returned as corrupt.
+	LoadJobs() ([]Job, []CorruptJob, error)
+}
+
+// Store is what the -store flag decides the home of: videos, their runs,
+// outputs and tags, collections and jobs. Everything else stays as files under the
+// data directory whichever Store is used, read and written by the processor
+// through its own directories and by the web handler through its data
+// directory:
+//
+//	videos/<id>/chats/<chatID>.json      chats, see SaveChat
+//	videos/<id>/pipelines/<runID>.json   pipeline runs, see SavePipelineRun
+//	pipelines/<name>.json                saved pipelines
+//	syntheses/<id>.json                  syntheses, with outputs as <id>.md
+//	embeddings/                          semantic search embeddings
+//	subscriptions/<channelID>.json       channel subscriptions
+type Store interface {
+	VideoStore
+	RunStore
+	CollectionStore
+	TagStore
+	JobStore
+	Close() error
+}
+
+// FSStore keeps everything as files under a data directory:
+//
+//	videos/<id>/data.json              the video
+//	videos/<id>/<pattern>-<model>.md   outputs saved before runs were recorded
+//	videos/<id>/runs/<runID>.json      runs, with outputs as <runID>.md
+//	videos/<id>/tags.json              the video's tags
+//	collections/<id>.json
+//	jobs/<id>.json
+type FSStore struct {
+	videosDir      string
+	collectionsDir string
+	jobsDir        string
+}
+
+func NewFSStore(dataDir string) *FSStore {
+	return &FSStore{
+		videosDir:      filepath.Join(dataDir, "videos"),
+		collectionsDir: filepath.Join(dataDir, "collections"),
+		jobsDir:        filepath.Join(dataDir, "jobs"),
+	}
+}
+
+func (s *FSStore) LoadVideos() ([]yt.Video, []CorruptVideo, error) {
+	videos, corrupt, err := LoadVideos(s.videosDir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	for i := range videos {
+		videos[i].Transcript = ""
+		videos[i].Segments = nil
+		videos[i].Comments = nil
+	}
+	return videos, corrupt, err
+}
+
+func (s *FSStore) LoadVideo(videoID string) (*yt.Video, error) {
+	return LoadVideo(videoID, s.videosDir)
+}
+
+func (s *FSStore) SaveVideo(video yt.Video) error {
+	return SaveVideo(video, s.videosDir)
+}
+
+func (s *FSStore) DeleteVideo(videoID string) error {
+	return DeleteVideo(videoID, s.videosDir)
+}
+
+func (s *FSStore) LoadOutputs(videoID string) ([]string, error) {
+	files, err := LoadVideoFiles(videoID, s.videosDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var outputs []string
+	for _, file := range files {
+		if filepath.Ext(file) == ".md" {
+			outputs = append(outputs, file)
+		}
+	}
+	return outputs, nil
+}
+
+func (s *FSStore) LoadOutput(videoID string, name string) (string, error) {
+	// Only outputs are served, not data.json or anything else in the directory
+	if validOutputName(name) != nil {
+		return "", os.ErrNotExist
+	}
+	return LoadVideoSummary(videoID, s.videosDir, name)
+}
+
+func (s *FSStore) SaveOutput(videoID string, name string, output string) error {
+	if err := validOutputName(name); err != nil {
+		return err
+	}
+	path, err := dataPath(s.videosDir, videoID, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(output), 0644)
+}
+
+func (s *FSStore) SaveRun(run Run, output string) error {
+	return SaveRun(run, output, s.videosDir)
+}
+
+func (s *FSStore) SaveRunChunk(videoID string, runID string, part int, output string) error {
+	return SaveRunChunk(videoID, runID, part, output, s.videosDir)
+}
+
+func (s *FSStore) LoadRun(videoID string, runID string) (*Run, error) {
+	return LoadRun(videoID, runID, s.videosDir)
+}
+
+func (s *FSStore) LoadRunOutput(videoID string, runID string) (string, error) {
+	return LoadRunOutput(videoID, runID, s.videosDir)
+}
+
+func (s *FSStore) LoadRunChunks(videoID string, runID string) ([]string, error) {
+	return LoadRunChunks(videoID, runID, s.videosDir)
+}
+
+func (s *FSStore) LoadRuns(videoID string) ([]Run, []CorruptRun, error) {
+	return LoadRuns(videoID, s.videosDir)
+}
+
+func (s *FSStore) SaveCollection(collection Collection) error {
+	return SaveCollection(collection, s.collectionsDir)
+}
+
+func (s *FSStore) LoadCollection(collectionID string) (*Collection, error) {
+	return LoadCollection(collectionID, s.collectionsDir)
+}
+
+func (s *FSStore) LoadCollections() ([]Collection, error) {
+	return LoadCollections(s.collectionsDir)
+}
+
+func (s *FSStore) SaveTags(videoID string, tags []string) error {
+	return SaveTags(videoID, tags, s.videosDir)
+}
+
+func (s *FSStore) LoadTags(videoID string) ([]string, error) {
+	return LoadTags(videoID, s.videosDir)
+}
+
+func (s *FSStore) LoadAllTags() (map[string][]string, error) {
+	return LoadAllTags(s.videosDir)
+}
+
+func (s *FSStore) SaveJob(job Job) error {
+	return SaveJob(job, s.jobsDir)
+}
+
+func (s *FSStore) LoadJobs() ([]Job, []CorruptJob, error) {
+	return LoadJobs(s.jobsDir)
+}
+
+func (s *FSStore) Close() error {
+	return nil
+}
+
+// ImportStore copies everything in src into dst: videos with their outputs,
+// runs, run parts and tags, collections and jobs. Records already in dst are
+// overwritten, so an import can be repeated.
+func ImportStore(dst Store, src Store, logger *slog.Logger) error {
+	videos, corrupt, err := src.LoadVideos()
+	if err != nil {
+		return fmt.Errorf("failed to list videos: %v", err)
+	}
+	for _, video := range corrupt {
+		logger.Warn("Skipping corrupt video", "videoID", video.ID, "error", video.Error)
+	}
+	runCount := 0
+	for _, listed := range videos {
+		video, err := src.LoadVideo(listed.ID)
+		if err != nil || video == nil {
+			return fmt.Errorf("failed to load video %s: %v", listed.ID, err)
+		}
+		if err := dst.SaveVideo(*video); err != nil {
+			return fmt.Errorf("failed to import video %s: %v", video.ID, err)
+		}
+
+		outputs, err := src.LoadOutputs(video.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list outputs of %s: %v", video.ID, err)
+		}
+		for _, name := range outputs {
+			output, err := src.LoadOutput(video.ID, name)
+			if err != nil {
+				return fmt.Errorf("failed to load output %s of %s: %v", name, video.ID, err)
+			}
+			if err := dst.SaveOutput(video.ID, name, output); err != nil {
+				return fmt.Errorf("failed to import output %s of %s: %v", name, video.ID, err)
+			}
+		}
+
+		tags, err := src.LoadTags(video.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load tags of %s: %v", video.ID, err)
+		}
+		if err := dst.SaveTags(video.ID, tags); err != nil {
+			return fmt.Errorf("failed to import tags of %s: %v", video.ID, err)
+		}
+
+		runs, corruptRuns, err := src.LoadRuns(video.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load runs of %s: %v", video.ID, err)
+		}
+		for _, run := range corruptRuns {
+			logger.Warn("Skipping corrupt run", "videoID", video.ID, "runID", run.ID, "error", run.Error)
+		}
+		for _, run := range runs {
+			var output string
+			if run.Status == RunSucceeded {
+				if output, err = src.LoadRunOutput(video.ID, run.ID); err != nil {
+					return fmt.Errorf("failed to load output of run %s: %v", run.ID, err)
+				}
+			}
+			if err := dst.SaveRun(run, output); err != nil {
+				return fmt.Errorf("failed to import run %s: %v", run.ID, err)
+			}
+			chunks, err := src.LoadRunChunks(video.ID, run.ID)
+			if err != nil {
+				return fmt.Errorf("failed to load parts of run %s: %v", run.ID, err)
+			}
+			for i, chunk := range chunks {
+				if err := dst.SaveRunChunk(video.ID, run.ID, i+1, chunk); err != nil {
+					return fmt.Errorf("failed to import part %d of run %s: %v", i+1, run.ID, err)
+				}
+			}
+		}
+		runCount += len(runs)
+	}
+
+	collections, err := src.LoadCollections()
+	if err != nil {
+		return fmt.Errorf("failed to load collections: %v", err)
+	}
+	for _, collection := range collections {
+		if err := dst.SaveCollection(collection); err != nil {
+			return fmt.Errorf("failed to import collection %s: %v", collection.ID, err)
+		}
+	}
+
+	jobs, corruptJobs, err := src.LoadJobs()
+	if err != nil {
+		return fmt.Errorf("failed to load jobs: %v", err)
+	}
+	for _, job := range corruptJobs {
+		logger.Warn("Skipping corrupt job", "jobID", job.ID, "error", job.Error)
+	}
+	for _, job := range jobs {
+		if err := dst.SaveJob(job); err != nil {
+			return fmt.Errorf("failed to import job %s: %v", job.ID, err)
+		}
+	}
+	logger.Info("Import finished", "videos", len(videos), "runs", runCount, "collections", len(collections), "jobs", len(jobs))
+	return nil
+}
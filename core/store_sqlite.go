@@ -0,0 +1,460 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fabric-agents/yt"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations upgrade the schema one step at a time. The database's
+// user_version is the number of migrations applied; append new steps rather
+// than editing old ones.
+var sqliteMigrations = []string{
+	// 1: records are stored as JSON next to the columns they are looked up or sorted by
+	`CREATE TABLE videos (
+		id TEXT PRIMARY KEY,
+		title TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		-- listing is the video without its transcript, segments and comments
+		listing TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE outputs (
+		video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		output TEXT NOT NULL,
+		PRIMARY KEY (video_id, name)
+	);
+	CREATE TABLE runs (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+		pattern TEXT NOT NULL,
+		model TEXT NOT NULL,
+		status TEXT NOT NULL,
+		started_at TEXT NOT NULL,
+		data TEXT NOT NULL,
+		output TEXT
+	);
+	CREATE INDEX runs_by_video ON runs (video_id, started_at);
+	-- parts are saved before their run finishes and is saved itself
+	CREATE TABLE run_chunks (
+		video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+		run_id TEXT NOT NULL,
+		part INTEGER NOT NULL,
+		output TEXT NOT NULL,
+		PRIMARY KEY (run_id, part)
+	);
+	CREATE TABLE collections (
+		id TEXT PRIMARY KEY,
+		updated_at TEXT NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE jobs (
+		id TEXT PRIMARY KEY,
+		state TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		data TEXT NOT NULL
+	);`,
+	// 2: tags
+	`CREATE TABLE video_tags (
+		video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (video_id, tag)
+	);
+	CREATE INDEX video_tags_by_tag ON video_tags (tag);`,
+}
+
+// sqliteTimeLayout stores times in UTC with a fixed width so they sort as text
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// SQLiteStore keeps everything in a single SQLite database file
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens the database at path, creating it if needed, and
+// brings its schema up to date
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	store := &SQLiteStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *SQLiteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %v", version+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %v", version+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %v", version+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) LoadVideos() ([]yt.Video, []CorruptVideo, error) {
+	rows, err := s.db.Query("SELECT id, listing FROM videos ORDER BY id")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var videos []yt.Video
+	var corrupt []CorruptVideo
+	for rows.Next() {
+		var id, listing string
+		if err := rows.Scan(&id, &listing); err != nil {
+			return nil, nil, err
+		}
+		var video yt.Video
+		if err := json.Unmarshal([]byte(listing), &video); err != nil {
+			corrupt = append(corrupt, CorruptVideo{ID: id, Error: fmt.Sprintf("corrupt listing: %v", err)})
+			continue
+		}
+		videos = append(videos, video)
+	}
+	return videos, corrupt, rows.Err()
+}
+
+func (s *SQLiteStore) LoadVideo(videoID string) (*yt.Video, error) {
+	var video yt.Video
+	err := scanJSON(s.db.QueryRow("SELECT data FROM videos WHERE id = ?", videoID), &video)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+func (s *SQLiteStore) SaveVideo(video yt.Video) error {
+	if !ValidFileName(video.ID) {
+		return fmt.Errorf("invalid video ID %q", video.ID)
+	}
+	data, err := json.Marshal(video)
+	if err != nil {
+		return err
+	}
+	listed := video
+	listed.Transcript = ""
+	listed.Segments = nil
+	listed.Comments = nil
+	listing, err := json.Marshal(listed)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO videos (id, title, channel, listing, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, channel = excluded.channel, listing = excluded.listing, data = excluded.data`,
+		video.ID, video.Title, video.Channel, string(listing), string(data))
+	return err
+}
+
+func (s *SQLiteStore) DeleteVideo(videoID string) error {
+	_, err := s.db.Exec("DELETE FROM videos WHERE id = ?", videoID)
+	return err
+}
+
+func (s *SQLiteStore) LoadOutputs(videoID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT name FROM outputs WHERE video_id = ? ORDER BY name", videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *SQLiteStore) LoadOutput(videoID string, name string) (string, error) {
+	if validOutputName(name) != nil {
+		return "", os.ErrNotExist
+	}
+	var output string
+	err := s.db.QueryRow("SELECT output FROM outputs WHERE video_id = ? AND name = ?", videoID, name).Scan(&output)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", os.ErrNotExist
+	}
+	return output, err
+}
+
+func (s *SQLiteStore) SaveOutput(videoID string, name string, output string) error {
+	if !ValidFileName(videoID) {
+		return fmt.Errorf("invalid video ID %q", videoID)
+	}
+	if err := validOutputName(name); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO outputs (video_id, name, output) VALUES (?, ?, ?)
+		ON CONFLICT (video_id, name) DO UPDATE SET output = excluded.output`, videoID, name, output)
+	return err
+}
+
+func (s *SQLiteStore) SaveRun(run Run, output string) error {
+	// Runs keep the IDs the file layout needs so they can move between stores
+	if err := validRunID(run.VideoID, run.ID); err != nil {
+		return err
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	var storedOutput sql.NullString
+	if run.Status == RunSucceeded {
+		storedOutput = sql.NullString{String: output, Valid: true}
+	}
+	_, err = s.db.Exec(`INSERT INTO runs (id, video_id, pattern, model, status, started_at, data, output) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET status = excluded.status, data = excluded.data, output = excluded.output`,
+		run.ID, run.VideoID, run.Pattern, run.Model, string(run.Status), run.StartedAt.UTC().Format(sqliteTimeLayout), string(data), storedOutput)
+	return err
+}
+
+func (s *SQLiteStore) SaveRunChunk(videoID string, runID string, part int, output string) error {
+	if err := validRunID(videoID, runID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO run_chunks (video_id, run_id, part, output) VALUES (?, ?, ?, ?)
+		ON CONFLICT (run_id, part) DO UPDATE SET output = excluded.output`, videoID, runID, part, output)
+	return err
+}
+
+func (s *SQLiteStore) LoadRun(videoID string, runID string) (*Run, error) {
+	var run Run
+	err := scanJSON(s.db.QueryRow("SELECT data FROM runs WHERE id = ? AND video_id = ?", runID, videoID), &run)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *SQLiteStore) LoadRunOutput(videoID string, runID string) (string, error) {
+	var output sql.NullString
+	err := s.db.QueryRow("SELECT output FROM runs WHERE id = ? AND video_id = ?", runID, videoID).Scan(&output)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !output.Valid) {
+		return "", os.ErrNotExist
+	}
+	return output.String, err
+}
+
+func (s *SQLiteStore) LoadRunChunks(videoID string, runID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT output FROM run_chunks WHERE run_id = ? AND video_id = ? ORDER BY part", runID, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var chunks []string
+	for rows.Next() {
+		var chunk string
+		if err := rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+func (s *SQLiteStore) LoadRuns(videoID string) ([]Run, []CorruptRun, error) {
+	rows, err := s.db.Query("SELECT id, data FROM runs WHERE video_id = ? ORDER BY started_at DESC", videoID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var runs []Run
+	var corrupt []CorruptRun
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, nil, err
+		}
+		var run Run
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			corrupt = append(corrupt, CorruptRun{ID: id, Error: err.Error()})
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, corrupt, rows.Err()
+}
+
+func (s *SQLiteStore) SaveCollection(collection Collection) error {
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO collections (id, updated_at, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		collection.ID, collection.UpdatedAt.UTC().Format(sqliteTimeLayout), string(data))
+	return err
+}
+
+func (s *SQLiteStore) LoadCollection(collectionID string) (*Collection, error) {
+	var collection Collection
+	err := scanJSON(s.db.QueryRow("SELECT data FROM collections WHERE id = ?", collectionID), &collection)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+func (s *SQLiteStore) LoadCollections() ([]Collection, error) {
+	rows, err := s.db.Query("SELECT data FROM collections ORDER BY updated_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var collections []Collection
+	for rows.Next() {
+		var collection Collection
+		if err := scanJSON(rows, &collection); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
+
+func (s *SQLiteStore) SaveTags(videoID string, tags []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM videos WHERE id = ?)", videoID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("video %s not found", videoID)
+	}
+	if _, err := tx.Exec("DELETE FROM video_tags WHERE video_id = ?", videoID); err != nil {
+		return err
+	}
+	for _, tag := range NormalizeTags(tags) {
+		if _, err := tx.Exec("INSERT INTO video_tags (video_id, tag) VALUES (?, ?)", videoID, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) LoadTags(videoID string) ([]string, error) {
+	rows, err := s.db.Query("SELECT tag FROM video_tags WHERE video_id = ? ORDER BY tag", videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s *SQLiteStore) LoadAllTags() (map[string][]string, error) {
+	rows, err := s.db.Query("SELECT tag, video_id FROM video_tags ORDER BY tag, video_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	all := make(map[string][]string)
+	for rows.Next() {
+		var tag, videoID string
+		if err := rows.Scan(&tag, &videoID); err != nil {
+			return nil, err
+		}
+		all[tag] = append(all[tag], videoID)
+	}
+	return all, rows.Err()
+}
+
+func (s *SQLiteStore) SaveJob(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO jobs (id, state, created_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET state = excluded.state, data = excluded.data`,
+		job.ID, string(job.State), job.CreatedAt.UTC().Format(sqliteTimeLayout), string(data))
+	return err
+}
+
+func (s *SQLiteStore) LoadJobs() ([]Job, []CorruptJob, error) {
+	rows, err := s.db.Query("SELECT id, data FROM jobs ORDER BY created_at")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var jobs []Job
+	var corrupt []CorruptJob
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, nil, err
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			corrupt = append(corrupt, CorruptJob{ID: id, Error: err.Error()})
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, corrupt, rows.Err()
+}
+
+// scanJSON scans a single JSON column into v
+func scanJSON(row interface{ Scan(...any) error }, v interface{}) error {
+	var data string
+	if err := row.Scan(&data); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
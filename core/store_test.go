@@ -0,0 +1,420 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fabric-agents/yt"
+
+	_ "modernc.org/sqlite"
+)
+
+// testStores returns an empty FSStore and SQLiteStore
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	sqliteStore, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "fabric.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+	return map[string]Store{"fs": NewFSStore(t.TempDir()), "sqlite": sqliteStore}
+}
+
+func testVideo(id string) yt.Video {
+	return yt.Video{
+		ID:         id,
+		Title:      "Title of " + id,
+		Channel:    "Channel",
+		Transcript: "Hello there.",
+		Segments:   []yt.Segment{{Start: 1, Duration: 2, Text: "Hello there."}},
+	}
+}
+
+func TestStoreVideos(t *testing.T) {
+	for name, store := range testStores(t) {
+		if video, err := store.LoadVideo("aaaaaaaaaa1"); video != nil || err != nil {
+			t.Errorf("%s: LoadVideo of a missing video = %v, %v; want nil, nil", name, video, err)
+		}
+		for _, id := range []string{"bbbbbbbbbb2", "aaaaaaaaaa1"} {
+			if err := store.SaveVideo(testVideo(id)); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		updated := testVideo("aaaaaaaaaa1")
+		updated.Title = "Updated"
+		if err := store.SaveVideo(updated); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		video, err := store.LoadVideo("aaaaaaaaaa1")
+		if err != nil || video == nil {
+			t.Fatalf("%s: LoadVideo = %v, %v", name, video, err)
+		}
+		if !reflect.DeepEqual(*video, updated) {
+			t.Errorf("%s: LoadVideo = %+v, want %+v", name, *video, updated)
+		}
+
+		videos, corrupt, err := store.LoadVideos()
+		if err != nil || len(corrupt) != 0 {
+			t.Fatalf("%s: LoadVideos = %v, %v", name, corrupt, err)
+		}
+		if len(videos) != 2 || videos[0].ID != "aaaaaaaaaa1" || videos[0].Title != "Updated" || videos[1].ID != "bbbbbbbbbb2" {
+			t.Errorf("%s: LoadVideos = %+v", name, videos)
+		}
+		for _, listed := range videos {
+			if listed.Transcript != "" || listed.Segments != nil {
+				t.Errorf("%s: listing of %s carries its transcript", name, listed.ID)
+			}
+		}
+
+		if err := store.SaveOutput("aaaaaaaaaa1", "summarize-default.md", "An output."); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		outputs, err := store.LoadOutputs("aaaaaaaaaa1")
+		if err != nil || !reflect.DeepEqual(outputs, []string{"summarize-default.md"}) {
+			t.Errorf("%s: LoadOutputs = %v, %v", name, outputs, err)
+		}
+		if output, err := store.LoadOutput("aaaaaaaaaa1", "summarize-default.md"); err != nil || output != "An output." {
+			t.Errorf("%s: LoadOutput = %q, %v", name, output, err)
+		}
+		if _, err := store.LoadOutput("aaaaaaaaaa1", "missing.md"); !os.IsNotExist(err) {
+			t.Errorf("%s: LoadOutput of a missing output = %v, want not exist", name, err)
+		}
+
+		if err := store.DeleteVideo("aaaaaaaaaa1"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if video, _ := store.LoadVideo("aaaaaaaaaa1"); video != nil {
+			t.Errorf("%s: deleted video still loads", name)
+		}
+		if outputs, _ := store.LoadOutputs("aaaaaaaaaa1"); len(outputs) != 0 {
+			t.Errorf("%s: outputs of a deleted video: %v", name, outputs)
+		}
+	}
+}
+
+func TestStoreRuns(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	run := func(id string, minutes int, status RunStatus) Run {
+		return Run{ID: id, VideoID: "aaaaaaaaaa1", Pattern: "summarize", Model: "default", RunRecord: RunRecord{
+			Backend:    "fabric",
+			Status:     status,
+			StartedAt:  start.Add(time.Duration(minutes) * time.Minute),
+			FinishedAt: start.Add(time.Duration(minutes+1) * time.Minute),
+		}}
+	}
+	for name, store := range testStores(t) {
+		if err := store.SaveVideo(testVideo("aaaaaaaaaa1")); err != nil {
+			t.Fatal(err)
+		}
+		older, failed, newer := run("20260101-120000-00000001", 0, RunSucceeded), run("20260101-120500-00000002", 5, RunFailed), run("20260101-121000-00000003", 10, RunSucceeded)
+		failed.Error = "boom"
+		for _, r := range []Run{newer, older, failed} {
+			if err := store.SaveRun(r, "output of "+r.ID); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+
+		runs, corrupt, err := store.LoadRuns("aaaaaaaaaa1")
+		if err != nil || len(corrupt) != 0 {
+			t.Fatalf("%s: LoadRuns = %v, %v", name, corrupt, err)
+		}
+		var ids []string
+		for _, r := range runs {
+			ids = append(ids, r.ID)
+		}
+		if want := []string{newer.ID, failed.ID, older.ID}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: LoadRuns = %v, want newest first %v", name, ids, want)
+		}
+
+		loaded, err := store.LoadRun("aaaaaaaaaa1", failed.ID)
+		if err != nil || loaded.Error != "boom" || loaded.Status != RunFailed || !loaded.StartedAt.Equal(failed.StartedAt) {
+			t.Errorf("%s: LoadRun = %+v, %v", name, loaded, err)
+		}
+		if output, err := store.LoadRunOutput("aaaaaaaaaa1", older.ID); err != nil || output != "output of "+older.ID {
+			t.Errorf("%s: LoadRunOutput = %q, %v", name, output, err)
+		}
+		if _, err := store.LoadRunOutput("aaaaaaaaaa1", failed.ID); !os.IsNotExist(err) {
+			t.Errorf("%s: failed run has an output: %v", name, err)
+		}
+		if _, err := store.LoadRun("aaaaaaaaaa1", "20260101-000000-ffffffff"); !os.IsNotExist(err) {
+			t.Errorf("%s: LoadRun of a missing run = %v, want not exist", name, err)
+		}
+
+		for part := 3; part >= 1; part-- {
+			if err := store.SaveRunChunk("aaaaaaaaaa1", newer.ID, part, fmt.Sprintf("part %d", part)); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		chunks, err := store.LoadRunChunks("aaaaaaaaaa1", newer.ID)
+		if err != nil || !reflect.DeepEqual(chunks, []string{"part 1", "part 2", "part 3"}) {
+			t.Errorf("%s: LoadRunChunks = %q, %v", name, chunks, err)
+		}
+
+		if err := store.DeleteVideo("aaaaaaaaaa1"); err != nil {
+			t.Fatal(err)
+		}
+		if runs, _, _ := store.LoadRuns("aaaaaaaaaa1"); len(runs) != 0 {
+			t.Errorf("%s: runs of a deleted video: %v", name, runs)
+		}
+	}
+}
+
+func TestStoreRunChunksPastNinetyNine(t *testing.T) {
+	for name, store := range testStores(t) {
+		if err := store.SaveVideo(testVideo("aaaaaaaaaa1")); err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for part := 1; part <= 105; part++ {
+			want = append(want, fmt.Sprintf("part %d", part))
+			if err := store.SaveRunChunk("aaaaaaaaaa1", "20260101-120000-00000001", part, want[part-1]); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		chunks, err := store.LoadRunChunks("aaaaaaaaaa1", "20260101-120000-00000001")
+		if err != nil || !reflect.DeepEqual(chunks, want) {
+			t.Errorf("%s: LoadRunChunks = %q, %v; want parts in numeric order", name, chunks, err)
+		}
+	}
+}
+
+func TestStoreSkipsCorruptRuns(t *testing.T) {
+	good := Run{ID: "20260101-120000-00000001", VideoID: "aaaaaaaaaa1", Pattern: "summarize", RunRecord: RunRecord{Status: RunSucceeded}}
+	bad := Run{ID: "20260101-120000-00000002", VideoID: "aaaaaaaaaa1", Pattern: "summarize", RunRecord: RunRecord{Status: RunFailed}}
+	for name, store := range testStores(t) {
+		if err := store.SaveVideo(testVideo("aaaaaaaaaa1")); err != nil {
+			t.Fatal(err)
+		}
+		for _, run := range []Run{good, bad} {
+			if err := store.SaveRun(run, "output"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Truncate the second run's record
+		switch store := store.(type) {
+		case *FSStore:
+			path := filepath.Join(store.videosDir, "aaaaaaaaaa1", "runs", bad.ID+".json")
+			if err := os.WriteFile(path, []byte(`{"id": "2026`), 0644); err != nil {
+				t.Fatal(err)
+			}
+		case *SQLiteStore:
+			if _, err := store.db.Exec(`UPDATE runs SET data = '{"id": "2026' WHERE id = ?`, bad.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		runs, corrupt, err := store.LoadRuns("aaaaaaaaaa1")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(runs) != 1 || runs[0].ID != good.ID {
+			t.Errorf("%s: LoadRuns = %+v, want the readable run", name, runs)
+		}
+		if len(corrupt) != 1 || corrupt[0].ID != bad.ID || corrupt[0].Error == "" {
+			t.Errorf("%s: corrupt runs = %+v, want the truncated one", name, corrupt)
+		}
+	}
+}
+
+func TestStoreCollections(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, store := range testStores(t) {
+		older := Collection{ID: "list1", Title: "Older", Kind: "playlist", VideoIDs: []string{"aaaaaaaaaa1"}, UpdatedAt: now}
+		newer := Collection{ID: "list2", Title: "Newer", Kind: "playlist", VideoIDs: []string{"bbbbbbbbbb2", "aaaaaaaaaa1"}, UpdatedAt: now.Add(time.Hour)}
+		for _, collection := range []Collection{older, newer} {
+			if err := store.SaveCollection(collection); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		collection, err := store.LoadCollection("list2")
+		if err != nil || collection.Title != "Newer" || !reflect.DeepEqual(collection.VideoIDs, newer.VideoIDs) {
+			t.Errorf("%s: LoadCollection = %+v, %v", name, collection, err)
+		}
+		collections, err := store.LoadCollections()
+		if err != nil || len(collections) != 2 || collections[0].ID != "list2" {
+			t.Errorf("%s: LoadCollections = %+v, %v; want most recently updated first", name, collections, err)
+		}
+	}
+}
+
+func TestStoreTags(t *testing.T) {
+	for name, store := range testStores(t) {
+		for _, id := range []string{"aaaaaaaaaa1", "bbbbbbbbbb2"} {
+			if err := store.SaveVideo(testVideo(id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.SaveTags("aaaaaaaaaa1", []string{" Rust ", "talks", "rust", ""}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := store.SaveTags("bbbbbbbbbb2", []string{"talks"}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if tags, err := store.LoadTags("aaaaaaaaaa1"); err != nil || !reflect.DeepEqual(tags, []string{"rust", "talks"}) {
+			t.Errorf("%s: LoadTags = %q, %v", name, tags, err)
+		}
+		all, err := store.LoadAllTags()
+		want := map[string][]string{"rust": {"aaaaaaaaaa1"}, "talks": {"aaaaaaaaaa1", "bbbbbbbbbb2"}}
+		if err != nil || !reflect.DeepEqual(all, want) {
+			t.Errorf("%s: LoadAllTags = %v, %v; want %v", name, all, err, want)
+		}
+
+		// Saving replaces, and no tags clears them
+		if err := store.SaveTags("aaaaaaaaaa1", nil); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if tags, err := store.LoadTags("aaaaaaaaaa1"); err != nil || len(tags) != 0 {
+			t.Errorf("%s: LoadTags after clearing = %q, %v", name, tags, err)
+		}
+
+		if err := store.SaveTags("ccccccccccc", []string{"x"}); err == nil {
+			t.Errorf("%s: tagged a missing video", name)
+		}
+		if err := store.DeleteVideo("bbbbbbbbbb2"); err != nil {
+			t.Fatal(err)
+		}
+		if all, err := store.LoadAllTags(); err != nil || len(all) != 0 {
+			t.Errorf("%s: tags of a deleted video remain: %v, %v", name, all, err)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	long := strings.Repeat("abcdefghij", 6)
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"", "  "}, nil},
+		{[]string{"Go", "go", " GO "}, []string{"go"}},
+		{[]string{"machine   learning", "ai"}, []string{"ai", "machine learning"}},
+		{[]string{long}, []string{long[:maxTagLength]}},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTags(tt.tags); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NormalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+	if got := ParseTags("talks, Rust,,rust "); !reflect.DeepEqual(got, []string{"rust", "talks"}) {
+		t.Errorf("ParseTags = %q", got)
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fabric.db")
+
+	// A database created before tags existed
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(sqliteMigrations[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`PRAGMA user_version = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO videos (id, title, channel, listing, data) VALUES ('aaaaaaaaaa1', 'Old', '', '{"ID":"aaaaaaaaaa1","Title":"Old"}', '{"ID":"aaaaaaaaaa1","Title":"Old"}')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	for i := 0; i < 2; i++ {
+		store, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatalf("open %d: %v", i+1, err)
+		}
+		var version int
+		if err := store.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != len(sqliteMigrations) {
+			t.Errorf("open %d: schema version %d, %v; want %d", i+1, version, err, len(sqliteMigrations))
+		}
+		video, err := store.LoadVideo("aaaaaaaaaa1")
+		if err != nil || video == nil || video.Title != "Old" {
+			t.Errorf("open %d: video saved before the migration = %v, %v", i+1, video, err)
+		}
+		if err := store.SaveTags("aaaaaaaaaa1", []string{"old"}); err != nil {
+			t.Errorf("open %d: tags after the migration: %v", i+1, err)
+		}
+		store.Close()
+	}
+}
+
+func TestImportStore(t *testing.T) {
+	dataDir := t.TempDir()
+	src := NewFSStore(dataDir)
+	video := testVideo("aaaaaaaaaa1")
+	run := Run{ID: "20260101-120000-00000001", VideoID: video.ID, Pattern: "summarize", Model: "default", Chunks: 2,
+		RunRecord: RunRecord{Status: RunSucceeded, StartedAt: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}}
+	collection := Collection{ID: "list1", Title: "List", VideoIDs: []string{video.ID}, UpdatedAt: time.Now().UTC()}
+	job := Job{ID: "20260101-120000-00000002", Kind: JobFetch, State: JobSucceeded, Params: map[string]string{"link": "x"}, CreatedAt: time.Now().UTC()}
+	for _, err := range []error{
+		src.SaveVideo(video),
+		src.SaveVideo(testVideo("bbbbbbbbbb2")),
+		src.SaveOutput(video.ID, "summarize-default.md", "An old output."),
+		src.SaveRun(run, "The output."),
+		src.SaveRunChunk(video.ID, run.ID, 1, "Part one."),
+		src.SaveRunChunk(video.ID, run.ID, 2, "Part two."),
+		src.SaveTags(video.ID, []string{"rust"}),
+		src.SaveCollection(collection),
+		src.SaveJob(job),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A corrupt video is skipped rather than failing the import
+	if err := os.MkdirAll(filepath.Join(dataDir, "videos", "ccccccccccc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "videos", "ccccccccccc", "data.json"), []byte(`{"ID": "ccc`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "fabric.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	// Importing twice overwrites instead of failing
+	for i := 0; i < 2; i++ {
+		if err := ImportStore(dst, src, testLogger()); err != nil {
+			t.Fatalf("import %d: %v", i+1, err)
+		}
+	}
+
+	if got, err := dst.LoadVideo(video.ID); err != nil || got == nil || !reflect.DeepEqual(*got, video) {
+		t.Errorf("imported video = %+v, %v", got, err)
+	}
+	if videos, corrupt, _ := dst.LoadVideos(); len(videos) != 2 || len(corrupt) != 0 {
+		t.Errorf("imported %d videos and %d corrupt ones, want 2 and none", len(videos), len(corrupt))
+	}
+	if output, err := dst.LoadOutput(video.ID, "summarize-default.md"); err != nil || output != "An old output." {
+		t.Errorf("imported output = %q, %v", output, err)
+	}
+	if got, err := dst.LoadRun(video.ID, run.ID); err != nil || got.Chunks != 2 || got.Status != RunSucceeded {
+		t.Errorf("imported run = %+v, %v", got, err)
+	}
+	if output, err := dst.LoadRunOutput(video.ID, run.ID); err != nil || output != "The output." {
+		t.Errorf("imported run output = %q, %v", output, err)
+	}
+	if chunks, err := dst.LoadRunChunks(video.ID, run.ID); err != nil || !reflect.DeepEqual(chunks, []string{"Part one.", "Part two."}) {
+		t.Errorf("imported run parts = %q, %v", chunks, err)
+	}
+	if tags, err := dst.LoadTags(video.ID); err != nil || !reflect.DeepEqual(tags, []string{"rust"}) {
+		t.Errorf("imported tags = %q, %v", tags, err)
+	}
+	if got, err := dst.LoadCollection("list1"); err != nil || !reflect.DeepEqual(got.VideoIDs, collection.VideoIDs) {
+		t.Errorf("imported collection = %+v, %v", got, err)
+	}
+	if jobs, _, err := dst.LoadJobs(); err != nil || len(jobs) != 1 || jobs[0].ID != job.ID || jobs[0].Params["link"] != "x" {
+		t.Errorf("imported jobs = %+v, %v", jobs, err)
+	}
+}
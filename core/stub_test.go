@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+// stubSource is a Source, PlaylistSource and ChannelSource serving canned
+// videos, playlists and a channel feed. Links look like stub://video/<id>
+// and stub://playlist/<id>.
+type stubSource struct {
+	videos    map[string]yt.Video
+	failures  map[string]error
+	playlists map[string]yt.Playlist
+	feed      yt.ChannelFeed
+	// onFeed, when set, is called whenever the feed is fetched
+	onFeed func()
+
+	// fetched lists the IDs of every video asked for, in order
+	fetched []string
+}
+
+func (s *stubSource) Name() string {
+	return "stub"
+}
+
+func (s *stubSource) GetVideoID(link string) string {
+	id, _ := strings.CutPrefix(link, "stub://video/")
+	if id == link {
+		return ""
+	}
+	return id
+}
+
+func (s *stubSource) GetVideoInfo(link string) (*yt.Video, error) {
+	id := s.GetVideoID(link)
+	s.fetched = append(s.fetched, id)
+	if err := s.failures[id]; err != nil {
+		return nil, err
+	}
+	video, ok := s.videos[id]
+	if !ok {
+		return nil, fmt.Errorf("no video %s", id)
+	}
+	return &video, nil
+}
+
+func (s *stubSource) VideoURL(videoID string) string {
+	return "stub://video/" + videoID
+}
+
+func (s *stubSource) ValidVideoID(videoID string) bool {
+	return len(videoID) == 11 && ValidFileName(videoID)
+}
+
+func (s *stubSource) GetPlaylistID(link string) string {
+	id, _ := strings.CutPrefix(link, "stub://playlist/")
+	if id == link {
+		return ""
+	}
+	return id
+}
+
+func (s *stubSource) GetPlaylist(link string) (*yt.Playlist, error) {
+	playlist, ok := s.playlists[s.GetPlaylistID(link)]
+	if !ok {
+		return nil, fmt.Errorf("no playlist %s", link)
+	}
+	return &playlist, nil
+}
+
+func (s *stubSource) ResolveChannelID(input string) (string, error) {
+	return input, nil
+}
+
+func (s *stubSource) ChannelURL(channelID string) string {
+	return "stub://channel/" + channelID
+}
+
+func (s *stubSource) GetChannelFeed(channelID string) (*yt.ChannelFeed, error) {
+	if s.onFeed != nil {
+		s.onFeed()
+	}
+	feed := s.feed
+	return &feed, nil
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// newTestProcessor returns a processor keeping its data in a temporary directory
+func newTestProcessor(t *testing.T, sources ...Source) (*Processor, string) {
+	t.Helper()
+	dataDir := t.TempDir()
+	return NewProcessor(testLogger(), dataDir, sources...), dataDir
+}
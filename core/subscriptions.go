@@ -0,0 +1,355 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fabric-agents/yt"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobPoll is the job kind polling a subscription on request
+const JobPoll = "poll"
+
+// maxUploadAttempts is how many polls try to ingest an upload before giving up on it
+const maxUploadAttempts = 5
+
+// Subscription is a channel whose new uploads are fetched automatically
+type Subscription struct {
+	ChannelID string    `json:"channel_id"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Pattern   string    `json:"pattern,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	LastSeenVideoID   string    `json:"last_seen_video_id"`
+	LastSeenPublished time.Time `json:"last_seen_published"`
+	LastPolledAt      time.Time `json:"last_polled_at"`
+	LastError         string    `json:"last_error,omitempty"`
+	// Failed are uploads past LastSeenVideoID that failed to ingest and are
+	// retried on later polls
+	Failed []FailedUpload `json:"failed,omitempty"`
+}
+
+// FailedUpload is an upload of a subscribed channel that failed to ingest
+type FailedUpload struct {
+	yt.FeedEntry
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+	Error       string    `json:"error"`
+}
+
+// ChannelSource is implemented by sources that publish a feed of channel uploads
+type ChannelSource interface {
+	ResolveChannelID(input string) (string, error)
+	ChannelURL(channelID string) string
+	GetChannelFeed(channelID string) (*yt.ChannelFeed, error)
+}
+
+// Subscriptions polls subscribed channels and ingests their new uploads
+type Subscriptions struct {
+	logger    *slog.Logger
+	dataDir   string
+	processor *Processor
+	channels  ChannelSource
+	jobs      *JobQueue
+
+	// mu guards the subscription files and polling, the channels being
+	// polled. It is not held while polls fetch from the network; polling
+	// keeps a manual poll from racing the scheduled one of the same channel.
+	mu      sync.Mutex
+	polling map[string]bool
+}
+
+func NewSubscriptions(logger *slog.Logger, dataDir string, processor *Processor, channels ChannelSource) *Subscriptions {
+	return &Subscriptions{logger: logger, dataDir: dataDir, processor: processor, channels: channels, polling: make(map[string]bool)}
+}
+
+// RegisterJobs registers the poll job kind on the queue so polls asked for
+// from the web run in the background through EnqueuePoll
+func (s *Subscriptions) RegisterJobs(q *JobQueue) {
+	s.jobs = q
+	q.Register(JobPoll, s.runPollJob)
+}
+
+// EnqueuePoll queues a job polling a subscription
+func (s *Subscriptions) EnqueuePoll(channelID string) (Job, error) {
+	sub, err := LoadSubscription(channelID, s.dataDir)
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to load subscription: %v", err)
+	}
+	return s.jobs.Enqueue(JobPoll, "Poll "+sub.Title, map[string]string{"channelID": channelID})
+}
+
+func (s *Subscriptions) runPollJob(ctx context.Context, job Job, progress func(string)) (string, error) {
+	return "/subscriptions", s.Poll(job.Params["channelID"], progress)
+}
+
+// Start polls every subscription once per interval until the process exits
+func (s *Subscriptions) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.PollAll()
+		}
+	}()
+}
+
+// Subscribe registers a channel by URL, handle or channel ID. Uploads already
+// in the feed are marked as seen so only later uploads are ingested.
+func (s *Subscriptions) Subscribe(channel string, pattern string, model string) (*Subscription, error) {
+	channelID, err := s.channels.ResolveChannelID(channel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve channel: %v", err)
+	}
+	feed, err := s.channels.GetChannelFeed(channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch channel feed: %v", err)
+	}
+
+	sub := Subscription{
+		ChannelID:    channelID,
+		Title:        feed.Title,
+		URL:          s.channels.ChannelURL(channelID),
+		Pattern:      strings.TrimSpace(pattern),
+		Model:        strings.TrimSpace(model),
+		CreatedAt:    time.Now(),
+		LastPolledAt: time.Now(),
+	}
+	if len(feed.Entries) > 0 {
+		sub.LastSeenVideoID = feed.Entries[0].VideoID
+		sub.LastSeenPublished = feed.Entries[0].Published
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := SaveSubscription(sub, s.dataDir); err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %v", err)
+	}
+	s.logger.Info("Subscribed to channel", "channelID", channelID, "title", sub.Title)
+	return &sub, nil
+}
+
+// Unsubscribe removes a subscription. Videos already ingested are kept.
+func (s *Subscriptions) Unsubscribe(channelID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := dataPath(s.dataDir, channelID+".json")
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// List returns all subscriptions ordered by title
+func (s *Subscriptions) List() ([]Subscription, error) {
+	return LoadSubscriptions(s.dataDir)
+}
+
+// PollAll polls every subscription, logging failures rather than stopping at the first one
+func (s *Subscriptions) PollAll() {
+	subs, err := LoadSubscriptions(s.dataDir)
+	if err != nil {
+		s.logger.Error("Failed to load subscriptions", "error", err)
+		return
+	}
+	for _, sub := range subs {
+		if err := s.Poll(sub.ChannelID, func(string) {}); err != nil {
+			s.logger.Error("Failed to poll subscription", "channelID", sub.ChannelID, "error", err)
+		}
+	}
+}
+
+// Poll fetches a channel's feed and ingests uploads newer than the last one
+// seen, oldest first, reporting each to progress. An upload that fails to
+// ingest, such as a members-only video or a premiere without captions yet, is
+// set aside so it can't hold up later uploads and retried on the next polls,
+// up to maxUploadAttempts times. Errors are saved with the poll state to show
+// up on the subscriptions page.
+func (s *Subscriptions) Poll(channelID string, progress func(string)) error {
+	s.mu.Lock()
+	if s.polling[channelID] {
+		s.mu.Unlock()
+		progress("Already being polled\n")
+		return nil
+	}
+	sub, err := LoadSubscription(channelID, s.dataDir)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.polling[channelID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.polling, channelID)
+		s.mu.Unlock()
+	}()
+	s.logger.Debug("Polling subscription", "channelID", channelID)
+
+	pollErr := s.poll(sub, progress)
+
+	// The subscription may have been changed or removed while polling
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := LoadSubscription(channelID, s.dataDir)
+	if os.IsNotExist(err) {
+		return pollErr
+	}
+	if err != nil {
+		return err
+	}
+	current.Title = sub.Title
+	current.LastSeenVideoID = sub.LastSeenVideoID
+	current.LastSeenPublished = sub.LastSeenPublished
+	current.Failed = sub.Failed
+	current.LastPolledAt = time.Now()
+	current.LastError = ""
+	if pollErr != nil {
+		current.LastError = pollErr.Error()
+	}
+	if err := SaveSubscription(*current, s.dataDir); err != nil {
+		return fmt.Errorf("failed to save subscription: %v", err)
+	}
+	return pollErr
+}
+
+func (s *Subscriptions) poll(sub *Subscription, progress func(string)) error {
+	feed, err := s.channels.GetChannelFeed(sub.ChannelID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch channel feed: %v", err)
+	}
+	if feed.Title != "" {
+		sub.Title = feed.Title
+	}
+
+	var newEntries []yt.FeedEntry
+	for _, entry := range feed.Entries {
+		if entry.VideoID == sub.LastSeenVideoID || !entry.Published.After(sub.LastSeenPublished) {
+			break
+		}
+		newEntries = append(newEntries, entry)
+	}
+
+	var failures []string
+	var failed []FailedUpload
+	for _, upload := range sub.Failed {
+		s.logger.Info("Retrying upload", "channelID", sub.ChannelID, "videoID", upload.VideoID, "attempt", upload.Attempts+1)
+		if err := s.ingest(sub, upload.FeedEntry); err != nil {
+			upload.Attempts++
+			upload.LastAttempt = time.Now()
+			upload.Error = err.Error()
+			failures = append(failures, err.Error())
+			if upload.Attempts >= maxUploadAttempts {
+				s.logger.Error("Giving up on upload", "channelID", sub.ChannelID, "videoID", upload.VideoID, "attempts", upload.Attempts, "error", err)
+				progress(fmt.Sprintf("Gave up on %s after %d attempts: %v\n", upload.Title, upload.Attempts, err))
+				continue
+			}
+			s.logger.Error("Failed to ingest upload", "channelID", sub.ChannelID, "videoID", upload.VideoID, "error", err)
+			progress(fmt.Sprintf("Retry of %s failed: %v\n", upload.Title, err))
+			failed = append(failed, upload)
+		} else {
+			progress(fmt.Sprintf("Ingested %s\n", upload.Title))
+		}
+	}
+
+	for i := len(newEntries) - 1; i >= 0; i-- {
+		entry := newEntries[i]
+		s.logger.Info("Ingesting new upload", "channelID", sub.ChannelID, "videoID", entry.VideoID, "title", entry.Title)
+		if err := s.ingest(sub, entry); err != nil {
+			s.logger.Error("Failed to ingest upload", "channelID", sub.ChannelID, "videoID", entry.VideoID, "error", err)
+			progress(fmt.Sprintf("Skipped %s for now: %v\n", entry.Title, err))
+			failures = append(failures, err.Error())
+			failed = append(failed, FailedUpload{FeedEntry: entry, Attempts: 1, LastAttempt: time.Now(), Error: err.Error()})
+		} else {
+			progress(fmt.Sprintf("Ingested %s\n", entry.Title))
+		}
+		sub.LastSeenVideoID = entry.VideoID
+		sub.LastSeenPublished = entry.Published
+	}
+	sub.Failed = failed
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// ingest fetches a new upload and queues the subscription's pattern over it
+func (s *Subscriptions) ingest(sub *Subscription, entry yt.FeedEntry) error {
+	videoID, err := s.processor.FetchVideo(entry.URL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", entry.VideoID, err)
+	}
+	if sub.Pattern != "" {
+		if _, err := s.processor.EnqueueProcess(videoID, sub.Model, sub.Pattern); err != nil {
+			return fmt.Errorf("failed to queue processing of %s: %v", entry.VideoID, err)
+		}
+	}
+	return nil
+}
+
+func SaveSubscription(sub Subscription, dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	path, err := dataPath(dataDir, sub.ChannelID+".json")
+	if err != nil {
+		return err
+	}
+	subJSON, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, subJSON, 0644)
+}
+
+func LoadSubscription(channelID string, dataDir string) (*Subscription, error) {
+	path, err := dataPath(dataDir, channelID+".json")
+	if err != nil {
+		return nil, err
+	}
+	subJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sub Subscription
+	if err := json.Unmarshal(subJSON, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// LoadSubscriptions loads all subscriptions ordered by title
+func LoadSubscriptions(dataDir string) ([]Subscription, error) {
+	files, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []Subscription
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		sub, err := LoadSubscription(strings.TrimSuffix(file.Name(), ".json"), dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load subscription %s: %v", file.Name(), err)
+		}
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return strings.ToLower(subs[i].Title) < strings.ToLower(subs[j].Title)
+	})
+	return subs, nil
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fabric-agents/yt"
+)
+
+func TestPollRetriesFailedUploads(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(id string, hours int) yt.FeedEntry {
+		return yt.FeedEntry{VideoID: id, Title: id, URL: "stub://video/" + id, Published: start.Add(time.Duration(hours) * time.Hour)}
+	}
+	source := &stubSource{
+		videos: map[string]yt.Video{
+			"bbbbbbbbbb2": {ID: "bbbbbbbbbb2", Title: "b"},
+			"cccccccccc3": {ID: "cccccccccc3", Title: "c"},
+			"dddddddddd4": {ID: "dddddddddd4", Title: "d"},
+		},
+		failures: map[string]error{"bbbbbbbbbb2": fmt.Errorf("premiere without captions")},
+		feed: yt.ChannelFeed{Title: "Channel", Entries: []yt.FeedEntry{
+			entry("cccccccccc3", 3),
+			entry("bbbbbbbbbb2", 2),
+			entry("aaaaaaaaaa1", 1),
+		}},
+	}
+	p, dataDir := newTestProcessor(t, source)
+	subsDir := filepath.Join(dataDir, "subscriptions")
+	subs := NewSubscriptions(testLogger(), subsDir, p, source)
+	err := SaveSubscription(Subscription{
+		ChannelID:         "channel",
+		LastSeenVideoID:   "aaaaaaaaaa1",
+		LastSeenPublished: start.Add(time.Hour),
+	}, subsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var progress strings.Builder
+	err = subs.Poll("channel", func(text string) { progress.WriteString(text) })
+	if err == nil || !strings.Contains(err.Error(), "bbbbbbbbbb2") {
+		t.Fatalf("Poll error = %v, want the failed upload", err)
+	}
+	sub, err := LoadSubscription("channel", subsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.LastSeenVideoID != "cccccccccc3" {
+		t.Errorf("LastSeenVideoID = %q, want the poll to move past the failed upload", sub.LastSeenVideoID)
+	}
+	if !strings.Contains(sub.LastError, "premiere without captions") {
+		t.Errorf("LastError = %q, want the failure recorded", sub.LastError)
+	}
+	if len(sub.Failed) != 1 || sub.Failed[0].VideoID != "bbbbbbbbbb2" || sub.Failed[0].Attempts != 1 {
+		t.Errorf("Failed = %+v, want the failed upload kept for a retry", sub.Failed)
+	}
+	if video, _ := p.Store().LoadVideo("cccccccccc3"); video == nil {
+		t.Error("upload after the failed one was not ingested")
+	}
+	if !strings.Contains(progress.String(), "Skipped bbbbbbbbbb2") || !strings.Contains(progress.String(), "Ingested cccccccccc3") {
+		t.Errorf("progress = %q", progress.String())
+	}
+
+	// The next poll retries the failed upload, which now ingests, and picks
+	// up the new one
+	delete(source.failures, "bbbbbbbbbb2")
+	source.feed.Entries = append([]yt.FeedEntry{entry("dddddddddd4", 4)}, source.feed.Entries...)
+	source.fetched = nil
+	if err := subs.Poll("channel", func(string) {}); err != nil {
+		t.Fatalf("second Poll failed: %v", err)
+	}
+	if fmt.Sprint(source.fetched) != "[bbbbbbbbbb2 dddddddddd4]" {
+		t.Errorf("second poll fetched %v, want the retry and the new upload", source.fetched)
+	}
+	sub, _ = LoadSubscription("channel", subsDir)
+	if sub.LastError != "" || len(sub.Failed) != 0 {
+		t.Errorf("LastError = %q, Failed = %+v after a clean poll", sub.LastError, sub.Failed)
+	}
+}
+
+func TestPollGivesUpOnUploads(t *testing.T) {
+	source := &stubSource{failures: map[string]error{"bbbbbbbbbb2": fmt.Errorf("members only")}}
+	p, dataDir := newTestProcessor(t, source)
+	subsDir := filepath.Join(dataDir, "subscriptions")
+	subs := NewSubscriptions(testLogger(), subsDir, p, source)
+	upload := FailedUpload{FeedEntry: yt.FeedEntry{VideoID: "bbbbbbbbbb2", Title: "b", URL: "stub://video/bbbbbbbbbb2"}, Attempts: 1}
+	if err := SaveSubscription(Subscription{ChannelID: "channel", Failed: []FailedUpload{upload}}, subsDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 2; attempt <= maxUploadAttempts; attempt++ {
+		if err := subs.Poll("channel", func(string) {}); err == nil {
+			t.Fatalf("attempt %d: want the failure reported", attempt)
+		}
+	}
+	sub, err := LoadSubscription("channel", subsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.Failed) != 0 {
+		t.Errorf("Failed = %+v after %d attempts, want the upload given up on", sub.Failed, maxUploadAttempts)
+	}
+	if len(source.fetched) != maxUploadAttempts-1 {
+		t.Errorf("fetched %d times, want %d", len(source.fetched), maxUploadAttempts-1)
+	}
+}
+
+func TestPollDoesNotLockOutChanges(t *testing.T) {
+	source := &stubSource{}
+	p, dataDir := newTestProcessor(t, source)
+	subsDir := filepath.Join(dataDir, "subscriptions")
+	subs := NewSubscriptions(testLogger(), subsDir, p, source)
+	if err := SaveSubscription(Subscription{ChannelID: "channel"}, subsDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// While the feed is being fetched, a second poll of the channel is
+	// turned away and unsubscribing goes through
+	var progress strings.Builder
+	source.onFeed = func() {
+		source.onFeed = nil
+		if err := subs.Poll("channel", func(text string) { progress.WriteString(text) }); err != nil {
+			t.Errorf("overlapping Poll = %v", err)
+		}
+		if err := subs.Unsubscribe("channel"); err != nil {
+			t.Errorf("Unsubscribe during a poll = %v", err)
+		}
+	}
+	if err := subs.Poll("channel", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(progress.String(), "Already being polled") {
+		t.Errorf("overlapping poll progress = %q", progress.String())
+	}
+	if subscriptions, _ := subs.List(); len(subscriptions) != 0 {
+		t.Errorf("poll brought back the removed subscription: %+v", subscriptions)
+	}
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// JobSynthesis is the job kind running one pattern over several videos at once
+const JobSynthesis = "synthesis"
+
+// SynthesisFromTranscripts makes a synthesis read the videos' transcripts
+// rather than their outputs of another pattern
+const SynthesisFromTranscripts = "transcript"
+
+// Synthesis is a single pattern run over several videos. Each video's input,
+// its transcript or its latest output of a pattern, is joined under a header
+// naming the video. Syntheses are stored under the syntheses directory as
+// <id>.json, with the output next to it as <id>.md.
+type Synthesis struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Pattern string `json:"pattern"`
+	Model   string `json:"model"`
+	// From is SynthesisFromTranscripts or the pattern whose outputs were combined
+	From   string           `json:"from"`
+	Inputs []SynthesisInput `json:"inputs"`
+
+	RunRecord
+}
+
+// SynthesisInput is one source video of a synthesis
+type SynthesisInput struct {
+	VideoID string `json:"video_id"`
+	Title   string `json:"title"`
+	// RunID is the run whose output was used, when not reading transcripts
+	RunID string `json:"run_id,omitempty"`
+}
+
+// EnqueueSynthesis queues a job running a pattern over several videos at once
+func (p *Processor) EnqueueSynthesis(title string, videoIDs []string, pattern string, model string, from string) (Job, error) {
+	if len(videoIDs) < 2 {
+		return Job{}, fmt.Errorf("select at least two videos to synthesize")
+	}
+	if from == "" {
+		from = SynthesisFromTranscripts
+	}
+	description := fmt.Sprintf("Synthesize %d videos with %s", len(videoIDs), pattern)
+	if title != "" {
+		description += ": " + title
+	}
+	return p.jobs.Enqueue(JobSynthesis, description, map[string]string{
+		"title":    title,
+		"videoIDs": strings.Join(videoIDs, "\n"),
+		"pattern":  pattern,
+		"model":    model,
+		"from":     from,
+	})
+}
+
+func (p *Processor) runSynthesisJob(ctx context.Context, job Job, progress func(string)) (string, error) {
+	videoIDs := strings.Split(job.Params["videoIDs"], "\n")
+	synthesis, err := p.Synthesize(ctx, job.Params["title"], videoIDs, job.Params["pattern"], job.Params["model"], job.Params["from"], progress)
+	if synthesis == nil {
+		return "", err
+	}
+	return "/syntheses/" + synthesis.ID, err
+}
+
+// Synthesize runs a pattern over the combined input of several videos and
+// saves the result, failed or not
+func (p *Processor) Synthesize(ctx context.Context, title string, videoIDs []string, pattern string, model string, from string, onChunk func(string)) (*Synthesis, error) {
+	p.logger.Info("Synthesizing videos", "videos", len(videoIDs), "pattern", pattern, "model", model, "from", from)
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	synthesis := &Synthesis{
+		ID:      id,
+		Title:   title,
+		Pattern: pattern,
+		Model:   model,
+		From:    from,
+	}
+
+	var input strings.Builder
+	for i, videoID := range videoIDs {
+		video, err := p.store.LoadVideo(videoID)
+		if err != nil || video == nil {
+			return nil, fmt.Errorf("failed to load video %s: %v", videoID, err)
+		}
+		source := SynthesisInput{VideoID: videoID, Title: video.Title}
+		text := video.Transcript
+		if from != SynthesisFromTranscripts {
+			run, output, err := p.LatestOutput(videoID, from)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load %s output of %s: %v", from, videoID, err)
+			}
+			if run == nil {
+				return nil, fmt.Errorf("%s has no %s output", video.Title, from)
+			}
+			source.RunID = run.ID
+			text = output
+		}
+		synthesis.Inputs = append(synthesis.Inputs, source)
+
+		fmt.Fprintf(&input, "# Video %d of %d: %s\n\n", i+1, len(videoIDs), video.Title)
+		if video.Channel != "" {
+			fmt.Fprintf(&input, "Channel: %s\n", video.Channel)
+		}
+		if video.URL != "" {
+			fmt.Fprintf(&input, "URL: %s\n", video.URL)
+		}
+		fmt.Fprintf(&input, "\n%s\n\n", strings.TrimSpace(text))
+	}
+	if synthesis.Title == "" {
+		synthesis.Title = fmt.Sprintf("%s over %d videos", pattern, len(videoIDs))
+	}
+
+	// Syntheses are not map-reduced: merging per-part outputs would lose the
+	// comparison across videos the pattern is run for
+	if tokens := EstimateTokens(input.String()); p.maxInputTokens > 0 && tokens > p.maxInputTokens {
+		hint := "select fewer videos"
+		if from == SynthesisFromTranscripts {
+			hint += " or combine their outputs of a pattern instead of their transcripts"
+		}
+		return nil, fmt.Errorf("the combined input of %d videos is about %d tokens, over the limit of %d: %s", len(videoIDs), tokens, p.maxInputTokens, hint)
+	}
+	output, runErr := p.execute(ctx, &synthesis.RunRecord, model, input.String(), func(ctx context.Context) (string, error) {
+		return p.backend.RunPattern(ctx, input.String(), pattern, model, onChunk)
+	})
+	if synthesis.Status == "" {
+		return nil, runErr
+	}
+
+	if err := SaveSynthesis(*synthesis, output, p.synthesesDir); err != nil {
+		return nil, fmt.Errorf("failed to save synthesis: %v", err)
+	}
+	if synthesis.Status == RunSucceeded {
+		p.search.IndexSynthesis(*synthesis, output)
+		p.embedSynthesis(*synthesis, output)
+	}
+	return synthesis, runErr
+}
+
+// LatestOutput returns a video's most recent successful run of a pattern,
+// with any model, and its output. The run is nil when there is none.
+func (p *Processor) LatestOutput(videoID string, pattern string) (*Run, string, error) {
+	runs, _, err := p.store.LoadRuns(videoID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, run := range runs {
+		if run.Pattern == pattern && run.Status == RunSucceeded {
+			output, err := p.store.LoadRunOutput(videoID, run.ID)
+			if err != nil {
+				return nil, "", err
+			}
+			return &run, output, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// LoadSyntheses returns the recorded syntheses, newest first
+func (p *Processor) LoadSyntheses() ([]Synthesis, error) {
+	return LoadSyntheses(p.synthesesDir)
+}
+
+// LoadSynthesis returns a synthesis and its output
+func (p *Processor) LoadSynthesis(id string) (*Synthesis, string, error) {
+	synthesis, err := LoadSynthesis(id, p.synthesesDir)
+	if err != nil {
+		return nil, "", err
+	}
+	if synthesis.Status != RunSucceeded {
+		return synthesis, "", nil
+	}
+	path, err := dataPath(p.synthesesDir, id+".md")
+	if err != nil {
+		return nil, "", err
+	}
+	output, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return synthesis, string(output), nil
+}
+
+func SaveSynthesis(synthesis Synthesis, output string, dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	path, err := dataPath(dataDir, synthesis.ID+".json")
+	if err != nil {
+		return err
+	}
+	if synthesis.Status == RunSucceeded {
+		if err := writeFileAtomic(strings.TrimSuffix(path, ".json")+".md", []byte(output), 0644); err != nil {
+			return err
+		}
+	}
+	synthesisJSON, err := json.Marshal(synthesis)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, synthesisJSON, 0644)
+}
+
+func LoadSynthesis(id string, dataDir string) (*Synthesis, error) {
+	path, err := dataPath(dataDir, id+".json")
+	if err != nil {
+		return nil, err
+	}
+	synthesisJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var synthesis Synthesis
+	if err := json.Unmarshal(synthesisJSON, &synthesis); err != nil {
+		return nil, err
+	}
+	return &synthesis, nil
+}
+
+// LoadSyntheses loads all syntheses, newest first
+func LoadSyntheses(dataDir string) ([]Synthesis, error) {
+	files, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var syntheses []Synthesis
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		synthesis, err := LoadSynthesis(strings.TrimSuffix(file.Name(), ".json"), dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load synthesis %s: %v", file.Name(), err)
+		}
+		syntheses = append(syntheses, *synthesis)
+	}
+	sort.Slice(syntheses, func(i, j int) bool {
+		return syntheses[i].StartedAt.After(syntheses[j].StartedAt)
+	})
+	return syntheses, nil
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"fabric-agents/yt"
+)
+
+func TestSynthesizeRecordsRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		primaryErr  error
+		wantBackend string
+	}{
+		{"primary", nil, "primary"},
+		{"fell back", errors.New("unreachable"), "fallback"},
+	}
+	for _, tt := range tests {
+		p, _ := newTestProcessor(t)
+		p.SetBackend(&FallbackBackend{
+			Primary:  &stubBackend{name: "primary", output: "combined", err: tt.primaryErr},
+			Fallback: &stubBackend{name: "fallback", output: "combined"},
+			Logger:   testLogger(),
+		})
+		for _, id := range []string{"aaaaaaaaaa1", "bbbbbbbbbb2"} {
+			if err := p.Store().SaveVideo(yt.Video{ID: id, Title: id, Transcript: "transcript of " + id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		synthesis, err := p.Synthesize(context.Background(), "", []string{"aaaaaaaaaa1", "bbbbbbbbbb2"}, "summarize", "default", SynthesisFromTranscripts, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		saved, output, err := p.LoadSynthesis(synthesis.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if output != "combined" || saved.Status != RunSucceeded || saved.Backend != tt.wantBackend {
+			t.Errorf("%s: saved %q with status %q backend %q", tt.name, output, saved.Status, saved.Backend)
+		}
+		if saved.SHA256 == "" || saved.InputTokens == 0 || saved.StartedAt.IsZero() || saved.FinishedAt.Before(saved.StartedAt) {
+			t.Errorf("%s: run bookkeeping missing: %+v", tt.name, saved.RunRecord)
+		}
+	}
+}
+
+func TestSynthesizeRejectsOversizedInput(t *testing.T) {
+	p, _ := newTestProcessor(t)
+	backend := &stubBackend{name: "stub", output: "combined"}
+	p.SetBackend(backend)
+	p.SetChunking(100, "")
+	for _, id := range []string{"aaaaaaaaaa1", "bbbbbbbbbb2"} {
+		if err := p.Store().SaveVideo(yt.Video{ID: id, Title: id, Transcript: strings.Repeat("word ", 50)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	synthesis, err := p.Synthesize(context.Background(), "", []string{"aaaaaaaaaa1", "bbbbbbbbbb2"}, "summarize", "default", SynthesisFromTranscripts, nil)
+	if err == nil || !strings.Contains(err.Error(), "over the limit of 100") {
+		t.Fatalf("got %v, %v; want an error about the input limit", synthesis, err)
+	}
+	if backend.runs != 0 {
+		t.Errorf("ran the pattern %d times over oversized input", backend.runs)
+	}
+	if syntheses, _ := p.LoadSyntheses(); len(syntheses) != 0 {
+		t.Errorf("saved %d syntheses of a rejected input", len(syntheses))
+	}
+}
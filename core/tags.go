@@ -0,0 +1,112 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTagLength is the longest tag kept, in characters
+const maxTagLength = 50
+
+// NormalizeTags trims and lowercases tags, drops empty and duplicate ones
+// and sorts them. Tags longer than maxTagLength characters are cut.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			tag = strings.TrimSpace(string([]rune(tag)[:maxTagLength]))
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// ParseTags splits a comma separated list of tags and normalizes them
+func ParseTags(text string) []string {
+	return NormalizeTags(strings.Split(text, ","))
+}
+
+// SaveTags replaces the tags of a stored video, kept in its directory as
+// tags.json. No tags removes the file.
+func SaveTags(videoID string, tags []string, dataDir string) error {
+	video, err := LoadVideo(videoID, dataDir)
+	if err != nil {
+		return err
+	}
+	if video == nil {
+		return fmt.Errorf("video %s not found", videoID)
+	}
+	path, err := dataPath(dataDir, videoID, "tags.json")
+	if err != nil {
+		return err
+	}
+	tags = NormalizeTags(tags)
+	if len(tags) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, tagsJSON, 0644)
+}
+
+// LoadTags returns the tags of a video, sorted
+func LoadTags(videoID string, dataDir string) ([]string, error) {
+	path, err := dataPath(dataDir, videoID, "tags.json")
+	if err != nil {
+		return nil, err
+	}
+	tagsJSON, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	if err := json.Unmarshal(tagsJSON, &tags); err != nil {
+		return nil, fmt.Errorf("corrupt tags.json: %v", err)
+	}
+	return tags, nil
+}
+
+// LoadAllTags returns every tag in use with the IDs of the videos carrying
+// it, sorted
+func LoadAllTags(dataDir string) (map[string][]string, error) {
+	files, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string][]string)
+	for _, file := range files {
+		if !file.IsDir() || !ValidFileName(file.Name()) {
+			continue
+		}
+		tags, err := LoadTags(file.Name(), dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tags of %s: %v", file.Name(), err)
+		}
+		for _, tag := range tags {
+			all[tag] = append(all[tag], file.Name())
+		}
+	}
+	return all, nil
+}
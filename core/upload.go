@@ -0,0 +1,52 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fabric-agents/yt"
+	"fmt"
+	"strings"
+)
+
+// UploadSourceName is the Video.Source value for videos imported from subtitle files
+const UploadSourceName = "upload"
+
+// ImportSubtitles parses an uploaded subtitle file and saves it as a new video
+// so it can be processed like any fetched video. It returns the generated video ID.
+func (p *Processor) ImportSubtitles(title string, filename string, data []byte) (string, error) {
+	p.logger.Info("Importing subtitles", "title", title, "filename", filename)
+	segments, err := yt.ParseSubtitles(filename, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse subtitles: %v", err)
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = filename
+	}
+	videoID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+
+	video := yt.Video{
+		ID:         videoID,
+		Source:     UploadSourceName,
+		Title:      title,
+		Transcript: yt.JoinSegments(segments),
+		Segments:   segments,
+	}
+	if err := p.store.SaveVideo(video); err != nil {
+		return "", fmt.Errorf("failed to save video: %v", err)
+	}
+	p.indexVideo(videoID)
+	return videoID, nil
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate video ID: %v", err)
+	}
+	return UploadSourceName + "-" + hex.EncodeToString(b), nil
+}
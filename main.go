@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"fabric-agents/core"
 	"fabric-agents/web"
@@ -12,6 +14,29 @@ import (
 	"log/slog"
 )
 
+type config struct {
+	port         string
+	captionPrefs []yt.CaptionPreference
+	pollInterval time.Duration
+	workers      int
+	perProvider  int
+	runTimeout   time.Duration
+	backend      string
+	fabricURL    string
+	openAIURL    string
+	openAIKey    string
+	openAIModel  string
+	patternsDir  string
+	maxTokens    int
+	reduce       string
+	embedURL     string
+	embedKey     string
+	embedModel   string
+	store        string
+	sqlitePath   string
+	importFS     bool
+}
+
 func main() {
 	// Initialize the logger
 	logHandler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
@@ -19,16 +44,121 @@ func main() {
 	})
 	logger := slog.New(logHandler)
 
-	port := flag.String("port", "8080", "Port for the web server")
+	var cfg config
+	var captions string
+	flag.StringVar(&cfg.port, "port", "8080", "Port for the web server")
+	flag.StringVar(&captions, "captions", yt.DefaultCaptionPreferences, "Caption track preference order, e.g. \"manual en, asr any\"")
+	flag.DurationVar(&cfg.pollInterval, "poll-interval", 30*time.Minute, "How often to poll subscribed channels (0 disables polling)")
+	flag.IntVar(&cfg.workers, "workers", 2, "Number of background jobs run at the same time")
+	flag.IntVar(&cfg.perProvider, "provider-concurrency", 2, "Number of pattern runs allowed on the same provider at the same time (0 disables the limit)")
+	flag.DurationVar(&cfg.runTimeout, "run-timeout", time.Hour, "Maximum duration of a single pattern run (0 disables the limit)")
+	flag.StringVar(&cfg.backend, "backend", "exec", "How to run patterns: \"exec\" runs the fabric binary, \"rest\" calls a fabric --serve instance, \"openai\" calls an OpenAI-compatible API directly")
+	flag.StringVar(&cfg.fabricURL, "fabric-url", "", "Base URL of the fabric REST server used by -backend rest, e.g. http://localhost:8081 for fabric --serve --address :8081 (required with -backend rest)")
+	flag.StringVar(&cfg.openAIURL, "openai-url", "http://localhost:11434", "Base URL of the OpenAI-compatible API used by -backend openai")
+	flag.StringVar(&cfg.openAIKey, "openai-key", os.Getenv("OPENAI_API_KEY"), "API key for -backend openai (defaults to $OPENAI_API_KEY)")
+	flag.StringVar(&cfg.openAIModel, "openai-model", "", "Model used by -backend openai when \"default\" is selected")
+	flag.StringVar(&cfg.patternsDir, "patterns-dir", defaultPatternsDir(), "Directory of fabric patterns read by -backend openai")
+	flag.IntVar(&cfg.maxTokens, "max-input-tokens", 32000, "Estimated transcript size in tokens above which patterns run per chunk and are merged (0 disables chunking)")
+	flag.StringVar(&cfg.reduce, "reduce-pattern", "", "Pattern merging per-chunk outputs of long transcripts (defaults to the pattern being run)")
+	flag.StringVar(&cfg.embedURL, "embeddings-url", "", "Base URL of an OpenAI-compatible /v1/embeddings API, e.g. http://localhost:11434 for Ollama (empty disables semantic search)")
+	flag.StringVar(&cfg.embedKey, "embeddings-key", os.Getenv("OPENAI_API_KEY"), "API key for -embeddings-url (defaults to $OPENAI_API_KEY)")
+	flag.StringVar(&cfg.embedModel, "embeddings-model", "nomic-embed-text", "Embedding model used for semantic search")
+	flag.StringVar(&cfg.store, "store", "fs", "Where videos, runs, collections and jobs are kept: \"fs\" for files under data/, \"sqlite\" for a SQLite database. Chats, pipelines, syntheses, embeddings and subscriptions stay under data/ either way.")
+	flag.StringVar(&cfg.sqlitePath, "sqlite-path", "data/fabric.db", "Database file used by -store sqlite")
+	flag.BoolVar(&cfg.importFS, "import", false, "Import the files under data/ into the -sqlite-path database and exit")
 	flag.Parse()
 
-	runWebServer(*port, logger)
+	captionPrefs, err := yt.ParseCaptionPreferences(captions)
+	if err != nil {
+		log.Fatalf("Invalid -captions: %v", err)
+	}
+	cfg.captionPrefs = captionPrefs
+
+	if cfg.importFS {
+		importStore(cfg, logger)
+		return
+	}
+	runWebServer(cfg, logger)
 }
 
-func runWebServer(port string, logger *slog.Logger) {
-	processor := core.NewProcessor(logger, "data/videos", yt.NewYT(""))
-	handler := web.NewHandler(processor, "data/videos", logger)
+func runWebServer(cfg config, logger *slog.Logger) {
+	youtube := yt.NewYT("")
+	youtube.SetCaptionPreferences(cfg.captionPrefs)
+	processor := core.NewProcessor(logger, "data", youtube)
+	switch cfg.store {
+	case "fs":
+	case "sqlite":
+		store, err := core.OpenSQLiteStore(cfg.sqlitePath)
+		if err != nil {
+			log.Fatalf("Failed to open store: %v", err)
+		}
+		defer store.Close()
+		processor.SetStore(store)
+	default:
+		log.Fatalf("Unknown -store %q", cfg.store)
+	}
+	processor.SetRunTimeout(cfg.runTimeout)
+	processor.SetProviderConcurrency(cfg.perProvider)
+	processor.SetChunking(cfg.maxTokens, cfg.reduce)
+	switch cfg.backend {
+	case "exec":
+	case "rest":
+		if cfg.fabricURL == "" {
+			log.Fatalf("-backend rest needs -fabric-url")
+		}
+		processor.SetBackend(&core.FallbackBackend{
+			Primary:  core.NewRESTBackend(cfg.fabricURL),
+			Fallback: core.ExecBackend{},
+			Logger:   logger,
+		})
+	case "openai":
+		processor.SetBackend(core.NewOpenAIBackend(cfg.openAIURL, cfg.openAIKey, cfg.openAIModel, cfg.patternsDir))
+	default:
+		log.Fatalf("Unknown -backend %q", cfg.backend)
+	}
+
+	if cfg.embedURL != "" {
+		processor.SetEmbedder(core.NewEmbedder(cfg.embedURL, cfg.embedKey, cfg.embedModel))
+	}
+	if err := processor.BuildSearchIndex(); err != nil {
+		logger.Error("Failed to build search index", "error", err)
+	}
+
+	jobs := core.NewJobQueue(logger, processor.Store(), cfg.workers)
+	processor.RegisterJobs(jobs)
+	subscriptions := core.NewSubscriptions(logger, "data/subscriptions", processor, youtube)
+	subscriptions.RegisterJobs(jobs)
+	if err := jobs.Start(); err != nil {
+		log.Fatalf("Failed to start job queue: %v", err)
+	}
+
+	if cfg.pollInterval > 0 {
+		subscriptions.Start(cfg.pollInterval)
+	}
+
+	handler := web.NewHandler(processor, jobs, subscriptions, "data/videos", logger)
 	http.Handle("/", handler)
-	logger.Info("Starting web server", "port", port)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+port, nil))
+	logger.Info("Starting web server", "port", cfg.port)
+	log.Fatal(http.ListenAndServe("0.0.0.0:"+cfg.port, nil))
+}
+
+// importStore copies the files under data/ into the SQLite database
+func importStore(cfg config, logger *slog.Logger) {
+	store, err := core.OpenSQLiteStore(cfg.sqlitePath)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+	if err := core.ImportStore(store, core.NewFSStore("data"), logger); err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+}
+
+// defaultPatternsDir is where `fabric --setup` installs its patterns
+func defaultPatternsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "patterns"
+	}
+	return filepath.Join(home, ".config", "fabric", "patterns")
 }
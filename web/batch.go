@@ -0,0 +1,108 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"fabric-agents/core"
+	"fabric-agents/yt"
+
+	"github.com/gorilla/mux"
+)
+
+// videoFilter reads the video list filter from the request
+func videoFilter(r *http.Request) core.VideoFilter {
+	return core.VideoFilter{
+		Query:        r.FormValue("q"),
+		CollectionID: r.FormValue("collection"),
+		Channel:      r.FormValue("channel"),
+		Tag:          r.FormValue("tag"),
+	}
+}
+
+// selectedVideos returns the videos picked on the videos page: the checked
+// ones, or with scope "matching" every video matching the filter
+func (h *Handler) selectedVideos(r *http.Request) ([]yt.Video, error) {
+	videos, _, err := h.store.LoadVideos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load videos: %v", err)
+	}
+	if r.FormValue("scope") == "matching" {
+		videos, err = h.processor.FilterVideos(videos, videoFilter(r))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		selected := make(map[string]bool)
+		for _, videoID := range r.Form["video"] {
+			selected[videoID] = true
+		}
+		var picked []yt.Video
+		for _, video := range videos {
+			if selected[video.ID] {
+				picked = append(picked, video)
+			}
+		}
+		videos = picked
+	}
+	if len(videos) == 0 {
+		return nil, fmt.Errorf("no videos selected")
+	}
+	return videos, nil
+}
+
+// handleBatchProcess queues a pattern run for the selected videos, or for
+// every video matching the filter, and replies with the per-video status
+func (h *Handler) handleBatchProcess(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	pattern, model := r.FormValue("pattern"), r.FormValue("model")
+	force := r.FormValue("force") != ""
+	h.logger.Debug("Handling /videos/batch request", "scope", r.FormValue("scope"), "pattern", pattern, "model", model, "force", force)
+	if pattern == "" {
+		http.Error(w, "Select a pattern", http.StatusBadRequest)
+		return
+	}
+
+	videos, err := h.selectedVideos(r)
+	if err != nil {
+		h.logger.Error("Failed to select videos", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items := h.processor.BatchProcess(videos, pattern, model, force)
+	tmpl, err := template.ParseFiles("web/templates/batch.html", "web/templates/job-state.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.ExecuteTemplate(w, "batch", map[string]interface{}{
+		"Pattern": pattern,
+		"Model":   model,
+		"Items":   items,
+	})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
+
+// handleJobBadge renders a job's state badge, which polls itself until the job is done
+func (h *Handler) handleJobBadge(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	job, ok := h.jobs.Get(jobID)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	tmpl, err := template.ParseFiles("web/templates/batch.html", "web/templates/job-state.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.ExecuteTemplate(w, "job-badge", job); err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"fabric-agents/core"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleChat(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+	chatID := r.URL.Query().Get("chat")
+	h.logger.Debug("Handling /videos/{id}/chat request", "method", r.Method, "videoID", videoID, "chatID", chatID)
+
+	if r.Method == "DELETE" {
+		if err := core.DeleteChat(videoID, chatID, h.dataDir); err != nil {
+			h.logger.Error("Failed to delete chat", "videoID", videoID, "chatID", chatID, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to delete chat: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("HX-Redirect", "/videos/"+videoID+"/chat")
+		return
+	}
+
+	tmpl, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("web/templates/layout.html", "web/templates/chat.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Answers stream on the job page, which comes back to the chat when done
+	if r.Method == "POST" {
+		r.ParseForm()
+		chatID = r.FormValue("chat_id")
+		question := r.FormValue("question")
+		job, err := h.processor.EnqueueChat(videoID, chatID, r.FormValue("model"), question)
+		if err != nil {
+			h.logger.Error("Failed to queue question", "videoID", videoID, "chatID", chatID, "error", err)
+			// Keep the conversation so far and the question so it can be asked again
+			data := map[string]interface{}{"VideoID": videoID, "Error": err.Error(), "Question": question}
+			if chatID != "" {
+				data["Chat"], _ = core.LoadChat(videoID, chatID, h.dataDir)
+			}
+			if err := tmpl.ExecuteTemplate(w, "chat-conversation", data); err != nil {
+				h.logger.Error("Failed to execute template", "error", err)
+			}
+			return
+		}
+		w.Header().Set("HX-Redirect", "/jobs/"+job.ID)
+		return
+	}
+
+	video, err := h.store.LoadVideo(videoID)
+	if err != nil || video == nil {
+		h.logger.Error("Failed to load video", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load video: %v", err), http.StatusNotFound)
+		return
+	}
+	chats, err := core.LoadChats(videoID, h.dataDir)
+	if err != nil {
+		h.logger.Warn("Failed to load chats", "videoID", videoID, "error", err)
+	}
+	var chat *core.Chat
+	if chatID != "" {
+		chat, err = core.LoadChat(videoID, chatID, h.dataDir)
+		if err != nil {
+			h.logger.Error("Failed to load chat", "videoID", videoID, "chatID", chatID, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to load chat: %v", err), http.StatusNotFound)
+			return
+		}
+	}
+	models, err := h.processor.ListModels(r.Context())
+	if err != nil {
+		h.logger.Warn("Failed to load models", "error", err)
+	}
+
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Title":     "Chat",
+		"VideoID":   videoID,
+		"Video":     video,
+		"Chats":     chats,
+		"Chat":      chat,
+		"AllModels": models,
+	})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"fabric-agents/core"
+
+	"github.com/gorilla/mux"
+)
+
+// compareColumn is one output shown on the compare page
+type compareColumn struct {
+	Label string
+	Link  string
+	// Run is nil for outputs saved before runs were recorded
+	Run    *core.Run
+	Output string
+	// Diff holds the changes from the first column in diff mode
+	Diff []core.DiffOp
+	// TooLarge is set in diff mode when the output was too large to diff
+	TooLarge bool
+}
+
+// handleCompare shows two or more outputs of a video side by side. Outputs
+// are picked with "run" (run IDs) and "file" (earlier output files)
+// parameters; "diff" switches to a word-level diff against the first one.
+func (h *Handler) handleCompare(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+	query := r.URL.Query()
+	h.logger.Debug("Handling /videos/{id}/compare request", "videoID", videoID, "runs", query["run"], "files", query["file"])
+
+	video, err := h.store.LoadVideo(videoID)
+	if err != nil || video == nil {
+		h.logger.Error("Failed to load video", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load video: %v", err), http.StatusNotFound)
+		return
+	}
+
+	var columns []compareColumn
+	for _, runID := range query["run"] {
+		run, err := h.store.LoadRun(videoID, runID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to load run %s: %v", runID, err), http.StatusNotFound)
+			return
+		}
+		output, err := h.store.LoadRunOutput(videoID, runID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Run %s has no output: %v", runID, err), http.StatusNotFound)
+			return
+		}
+		columns = append(columns, compareColumn{
+			Label:  fmt.Sprintf("%s · %s", run.Pattern, run.Model),
+			Link:   fmt.Sprintf("/videos/%s/runs/%s", videoID, runID),
+			Run:    run,
+			Output: output,
+		})
+	}
+	for _, file := range query["file"] {
+		output, err := h.store.LoadOutput(videoID, file)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to load %s: %v", file, err), http.StatusNotFound)
+			return
+		}
+		columns = append(columns, compareColumn{
+			Label:  file,
+			Link:   fmt.Sprintf("/videos/%s/%s", videoID, file),
+			Output: output,
+		})
+	}
+	if len(columns) < 2 {
+		http.Error(w, "Select at least two outputs to compare", http.StatusBadRequest)
+		return
+	}
+
+	// Diffs only make sense between outputs of the same pattern. Earlier
+	// output files don't record theirs, so they are taken at their word.
+	samePattern := true
+	for _, column := range columns {
+		if column.Run != nil && columns[0].Run != nil && column.Run.Pattern != columns[0].Run.Pattern {
+			samePattern = false
+		}
+	}
+	diff := samePattern && query.Get("diff") != ""
+	if diff {
+		for i := 1; i < len(columns); i++ {
+			var ok bool
+			columns[i].Diff, ok = core.DiffWords(columns[0].Output, columns[i].Output)
+			columns[i].TooLarge = !ok
+		}
+	}
+
+	// The same selection with diff mode toggled
+	toggle := r.URL.Query()
+	if diff {
+		toggle.Del("diff")
+	} else {
+		toggle.Set("diff", "1")
+	}
+
+	tmpl, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("web/templates/layout.html", "web/templates/compare.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Title":       "Compare",
+		"VideoID":     videoID,
+		"Video":       video,
+		"Columns":     columns,
+		"Diff":        diff,
+		"SamePattern": samePattern,
+		"ToggleURL":   fmt.Sprintf("/videos/%s/compare?%s", videoID, toggle.Encode()),
+	})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
@@ -3,11 +3,16 @@ package web
 import (
 	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"fabric-agents/core"
+	"fabric-agents/yt"
 
 	"github.com/gorilla/mux"
 	"github.com/russross/blackfriday/v2"
@@ -20,6 +25,10 @@ var templateFuncs = template.FuncMap{
 		html := blackfriday.Run([]byte(text))
 		return template.HTML(html)
 	},
+	"linkTimestamps": core.LinkTimestamps,
+	"add": func(a, b int) int {
+		return a + b
+	},
 	"formatVideoTitle": func(title string) template.HTML {
 		formattedTitle := cases.Title(language.English, cases.Compact).String(strings.ReplaceAll(title, "-", " "))
 		return template.HTML(fmt.Sprintf("<span class='text-2xl font-bold text-indigo-400'>%s</span>", formattedTitle))
@@ -27,17 +36,23 @@ var templateFuncs = template.FuncMap{
 }
 
 type Handler struct {
-	processor *core.Processor
-	router    *mux.Router
-	dataDir   string
-	logger    *slog.Logger
+	processor     *core.Processor
+	jobs          *core.JobQueue
+	subscriptions *core.Subscriptions
+	router        *mux.Router
+	store         core.Store
+	dataDir       string
+	logger        *slog.Logger
 }
 
-func NewHandler(p *core.Processor, dataDir string, logger *slog.Logger) *Handler {
+func NewHandler(p *core.Processor, jobs *core.JobQueue, subscriptions *core.Subscriptions, dataDir string, logger *slog.Logger) *Handler {
 	h := &Handler{
-		processor: p,
-		dataDir:   dataDir,
-		logger:    logger,
+		processor:     p,
+		jobs:          jobs,
+		subscriptions: subscriptions,
+		store:         p.Store(),
+		dataDir:       dataDir,
+		logger:        logger,
 	}
 	h.setupRoutes()
 	h.logger.Info("Handler initialized")
@@ -46,11 +61,36 @@ func NewHandler(p *core.Processor, dataDir string, logger *slog.Logger) *Handler
 
 func (h *Handler) setupRoutes() {
 	h.router = mux.NewRouter()
+	h.router.Use(h.validateVideoID)
 	h.router.HandleFunc("/", h.handleIndex)
 	h.router.HandleFunc("/submit-videos", h.handleSubmitVideos)
+	h.router.HandleFunc("/upload-subtitles", h.handleUploadSubtitles).Methods("POST")
 	h.router.HandleFunc("/videos", h.handleVideos)
+	h.router.HandleFunc("/videos/batch", h.handleBatchProcess).Methods("POST")
+	h.router.HandleFunc("/collections", h.handleCollections)
+	h.router.HandleFunc("/collections/{id}", h.handleCollectionByID)
+	h.router.HandleFunc("/search", h.handleSearch)
+	h.router.HandleFunc("/jobs", h.handleJobs)
+	h.router.HandleFunc("/jobs/{id}", h.handleJobByID)
+	h.router.HandleFunc("/jobs/{id}/events", h.handleJobEvents)
+	h.router.HandleFunc("/jobs/{id}/cancel", h.handleCancelJob).Methods("POST")
+	h.router.HandleFunc("/jobs/{id}/badge", h.handleJobBadge)
+	h.router.HandleFunc("/subscriptions", h.handleSubscriptions)
+	h.router.HandleFunc("/subscriptions/{id}", h.handleSubscriptionByID)
+	h.router.HandleFunc("/subscriptions/{id}/poll", h.handlePollSubscription).Methods("POST")
+	h.router.HandleFunc("/syntheses", h.handleSyntheses)
+	h.router.HandleFunc("/syntheses/{id}", h.handleSynthesisByID)
+	h.router.HandleFunc("/pipelines", h.handlePipelines)
+	h.router.HandleFunc("/pipelines/{name}", h.handlePipelineByName)
 	h.router.HandleFunc("/process-video", h.handleProcessVideo)
 	h.router.HandleFunc("/videos/{id}", h.handleVideoByID)
+	h.router.HandleFunc("/videos/{id}/transcript", h.handleRefetchTranscript).Methods("POST")
+	h.router.HandleFunc("/videos/{id}/tags", h.handleVideoTags).Methods("POST")
+	h.router.HandleFunc("/videos/{id}/pipelines", h.handleRunPipeline).Methods("POST")
+	h.router.HandleFunc("/videos/{id}/pipelines/{runID}", h.handlePipelineRun)
+	h.router.HandleFunc("/videos/{id}/runs/{runID}", h.handleRunByID)
+	h.router.HandleFunc("/videos/{id}/compare", h.handleCompare)
+	h.router.HandleFunc("/videos/{id}/chat", h.handleChat)
 	h.router.HandleFunc("/videos/{id}/{summary}", h.handleVideoByIDSummary)
 }
 
@@ -58,17 +98,120 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.router.ServeHTTP(w, r)
 }
 
+// validateVideoID answers 404 for /videos/{id} routes whose ID none of the
+// sources could have produced, before the ID gets near a file path
+func (h *Handler) validateVideoID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		videoID, ok := mux.Vars(r)["id"]
+		if ok && strings.HasPrefix(r.URL.Path, "/videos/") && !h.processor.ValidVideoID(videoID) {
+			h.logger.Warn("Rejected invalid video ID", "videoID", videoID, "path", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (h *Handler) handleVideos(w http.ResponseWriter, r *http.Request) {
 	h.logger.Debug("Handling /videos request")
-	videos, err := core.LoadVideos(h.dataDir)
+	videos, corrupt, err := h.store.LoadVideos()
 	if err != nil {
 		h.logger.Error("Failed to load videos", "error", err)
 		http.Error(w, fmt.Sprintf("Failed to load videos: %v", err), http.StatusInternalServerError)
 		return
 	}
+	for _, video := range corrupt {
+		h.logger.Warn("Skipping corrupt video", "videoID", video.ID, "error", video.Error)
+	}
+	channels := core.VideoChannels(videos)
+	filter := videoFilter(r)
+	videos, err = h.processor.FilterVideos(videos, filter)
+	if err != nil {
+		h.logger.Error("Failed to filter videos", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to filter videos: %v", err), http.StatusBadRequest)
+		return
+	}
+	collections, err := h.processor.LoadCollections()
+	if err != nil {
+		h.logger.Warn("Failed to load collections", "error", err)
+	}
+	allTags, err := h.store.LoadAllTags()
+	if err != nil {
+		h.logger.Warn("Failed to load tags", "error", err)
+	}
+	tagNames := make([]string, 0, len(allTags))
+	videoTags := make(map[string][]string)
+	for tag, videoIDs := range allTags {
+		tagNames = append(tagNames, tag)
+		for _, videoID := range videoIDs {
+			videoTags[videoID] = append(videoTags[videoID], tag)
+		}
+	}
+	sort.Strings(tagNames)
+	for _, tags := range videoTags {
+		sort.Strings(tags)
+	}
+	// The batch form is optional, so a missing fabric install only empties its selects
+	patterns, err := h.processor.ListPatterns(r.Context())
+	if err != nil {
+		h.logger.Warn("Failed to load patterns", "error", err)
+	}
+	models, err := h.processor.ListModels(r.Context())
+	if err != nil {
+		h.logger.Warn("Failed to load models", "error", err)
+	}
 
 	tmpl := template.Must(template.ParseFiles("web/templates/layout.html", "web/templates/videos.html"))
-	tmpl.Execute(w, map[string]interface{}{"Title": "Videos", "Videos": videos})
+	tmpl.Execute(w, map[string]interface{}{
+		"Title":       "Videos",
+		"Videos":      videos,
+		"Corrupt":     corrupt,
+		"Filter":      filter,
+		"Collections": collections,
+		"Channels":    channels,
+		"Tags":        tagNames,
+		"VideoTags":   videoTags,
+		"AllPatterns": patterns,
+		"AllModels":   models,
+	})
+}
+
+func (h *Handler) handleCollections(w http.ResponseWriter, r *http.Request) {
+	h.logger.Debug("Handling /collections request")
+	collections, err := h.processor.LoadCollections()
+	if err != nil {
+		h.logger.Error("Failed to load collections", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load collections: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("web/templates/layout.html", "web/templates/collections.html"))
+	tmpl.Execute(w, map[string]interface{}{"Title": "Collections", "Collections": collections})
+}
+
+func (h *Handler) handleCollectionByID(w http.ResponseWriter, r *http.Request) {
+	collectionID := mux.Vars(r)["id"]
+	h.logger.Debug("Handling /collections/{id} request", "collectionID", collectionID)
+	collection, err := h.processor.LoadCollection(collectionID)
+	if err != nil {
+		h.logger.Error("Failed to load collection", "collectionID", collectionID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load collection: %v", err), http.StatusNotFound)
+		return
+	}
+
+	// Members that have not been fetched (yet) are listed by ID only
+	var videos []yt.Video
+	for _, videoID := range collection.VideoIDs {
+		video, err := h.store.LoadVideo(videoID)
+		if err != nil || video == nil {
+			videos = append(videos, yt.Video{ID: videoID})
+			continue
+		}
+		videos = append(videos, *video)
+	}
+
+	tmpl := template.Must(template.ParseFiles("web/templates/layout.html", "web/templates/collection.html"))
+	tmpl.Execute(w, map[string]interface{}{"Title": collection.Title, "Collection": collection, "Videos": videos})
 }
 
 func (h *Handler) handleIndex(w http.ResponseWriter, r *http.Request) {
@@ -80,13 +223,49 @@ func (h *Handler) handleIndex(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleSubmitVideos(w http.ResponseWriter, r *http.Request) {
 	h.logger.Debug("Handling /submit-videos request")
 	videoLinks := r.FormValue("video_links")
-	videoLinksList := strings.Split(videoLinks, "\n")
-	for _, videoLink := range videoLinksList {
-		h.logger.Info("Processing video link", "link", videoLink)
-		h.processor.FetchVideo(videoLink)
+	count := 0
+	for _, link := range strings.Split(videoLinks, "\n") {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+		h.logger.Info("Queueing video link", "link", link)
+		if _, err := h.processor.EnqueueFetch(link); err != nil {
+			h.logger.Error("Failed to queue video link", "link", link, "error", err)
+			continue
+		}
+		count++
 	}
-	h.logger.Info("Videos processed", "count", len(videoLinksList))
-	fmt.Fprintf(w, "Videos processed: %d", len(videoLinksList))
+	h.logger.Info("Videos queued", "count", count)
+	fmt.Fprintf(w, `Videos queued: %d. Follow their progress on the <a href="/jobs" class="text-indigo-600 hover:text-indigo-800">jobs page</a>.`, count)
+}
+
+func (h *Handler) handleUploadSubtitles(w http.ResponseWriter, r *http.Request) {
+	h.logger.Debug("Handling /upload-subtitles request")
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse upload: %v", err), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("subtitles")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Missing subtitle file: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read subtitle file: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	videoID, err := h.processor.ImportSubtitles(r.FormValue("title"), header.Filename, data)
+	if err != nil {
+		h.logger.Error("Failed to import subtitles", "filename", header.Filename, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to import subtitles: %v", err), http.StatusBadRequest)
+		return
+	}
+	h.logger.Info("Subtitles imported", "videoID", videoID)
+	fmt.Fprintf(w, `Subtitles imported: <a href="/videos/%s" class="text-indigo-600 hover:text-indigo-800">%s</a>`, videoID, template.HTMLEscapeString(header.Filename))
 }
 
 func (h *Handler) handleVideoByID(w http.ResponseWriter, r *http.Request) {
@@ -97,7 +276,7 @@ func (h *Handler) handleVideoByID(w http.ResponseWriter, r *http.Request) {
 	// Check if this is a delete request
 	if r.Method == "DELETE" {
 		h.logger.Info("Deleting video", "videoID", videoID)
-		err := core.DeleteVideo(videoID, h.dataDir)
+		err := h.processor.DeleteVideo(videoID)
 		if err != nil {
 			h.logger.Error("Failed to delete video", "videoID", videoID, "error", err)
 			http.Error(w, fmt.Sprintf("Failed to delete video: %v", err), http.StatusInternalServerError)
@@ -108,25 +287,36 @@ func (h *Handler) handleVideoByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	video, err := core.LoadVideo(videoID, h.dataDir)
+	video, err := h.store.LoadVideo(videoID)
 	if err != nil {
 		h.logger.Error("Failed to load video", "videoID", videoID, "error", err)
 		http.Error(w, fmt.Sprintf("Failed to load video: %v", err), http.StatusInternalServerError)
 		return
 	}
-	files, err := core.LoadVideoFiles(videoID, h.dataDir)
+	if video == nil {
+		http.NotFound(w, r)
+		return
+	}
+	runs, corruptRuns, err := h.store.LoadRuns(videoID)
 	if err != nil {
-		h.logger.Error("Failed to load video files", "videoID", videoID, "error", err)
-		http.Error(w, fmt.Sprintf("Failed to load video files: %v", err), http.StatusInternalServerError)
+		h.logger.Error("Failed to load runs", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load runs: %v", err), http.StatusInternalServerError)
 		return
 	}
-	models, err := core.ListModels()
+	// Outputs saved before runs were recorded are still listed by file name
+	earlierOutputs, err := h.store.LoadOutputs(videoID)
+	if err != nil {
+		h.logger.Error("Failed to load outputs", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load outputs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	models, err := h.processor.ListModels(r.Context())
 	if err != nil {
 		h.logger.Error("Failed to load models", "error", err)
 		http.Error(w, fmt.Sprintf("Failed to load models: %v", err), http.StatusInternalServerError)
 		return
 	}
-	patterns, err := core.ListPatterns()
+	patterns, err := h.processor.ListPatterns(r.Context())
 	if err != nil {
 		h.logger.Error("Failed to load patterns", "error", err)
 		http.Error(w, fmt.Sprintf("Failed to load patterns: %v", err), http.StatusInternalServerError)
@@ -144,6 +334,21 @@ func (h *Handler) handleVideoByID(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to load models: %v", err), http.StatusInternalServerError)
 		return
 	}
+	pipelines, err := h.processor.LoadPipelines()
+	if err != nil {
+		h.logger.Warn("Failed to load pipelines", "error", err)
+	}
+	pipelineRuns, err := core.LoadPipelineRuns(videoID, h.dataDir)
+	if err != nil {
+		h.logger.Warn("Failed to load pipeline runs", "videoID", videoID, "error", err)
+	}
+	tags, err := h.store.LoadTags(videoID)
+	if err != nil {
+		h.logger.Warn("Failed to load tags", "videoID", videoID, "error", err)
+	}
+
+	// Search hits in the transcript link here with the second to start playing at
+	start, _ := strconv.Atoi(r.URL.Query().Get("t"))
 
 	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/video.html")
 	if err != nil {
@@ -153,14 +358,21 @@ func (h *Handler) handleVideoByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = tmpl.Execute(w, map[string]interface{}{
-		"Title":       "Video",
-		"VideoID":     videoID,
-		"VideoTitle":  video.Title,
-		"Files":       files,
-		"Models":      savedModels,
-		"Patterns":    savedPatterns,
-		"AllModels":   models,
-		"AllPatterns": patterns,
+		"Title":        "Video",
+		"VideoID":      videoID,
+		"VideoTitle":   video.Title,
+		"Start":        start,
+		"Video":        video,
+		"Runs":         runs,
+		"CorruptRuns":  corruptRuns,
+		"Files":        earlierOutputs,
+		"Models":       savedModels,
+		"Patterns":     savedPatterns,
+		"AllModels":    models,
+		"AllPatterns":  patterns,
+		"Pipelines":    pipelines,
+		"PipelineRuns": pipelineRuns,
+		"TagList":      strings.Join(tags, ", "),
 	})
 	if err != nil {
 		h.logger.Error("Failed to execute template", "error", err)
@@ -169,18 +381,48 @@ func (h *Handler) handleVideoByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *Handler) handleVideoTags(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+	tags := core.ParseTags(r.FormValue("tags"))
+	h.logger.Info("Tagging video", "videoID", videoID, "tags", tags)
+	if err := h.store.SaveTags(videoID, tags); err != nil {
+		h.logger.Error("Failed to save tags", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to save tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
+
 func (h *Handler) handleVideoByIDSummary(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	videoID := vars["id"]
 	summary := vars["summary"]
 	h.logger.Debug("Handling /videos/{id}/{summary} request", "videoID", videoID, "summary", summary)
+	if !core.ValidFileName(summary) {
+		http.NotFound(w, r)
+		return
+	}
 
-	summary, err := core.LoadVideoSummary(videoID, h.dataDir, summary)
+	summary, err := h.store.LoadOutput(videoID, summary)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to load video summary", "videoID", videoID, "summary", summary, "error", err)
 		http.Error(w, fmt.Sprintf("Failed to load video summary: %v", err), http.StatusInternalServerError)
 		return
 	}
+	video, err := h.store.LoadVideo(videoID)
+	if err != nil {
+		h.logger.Error("Failed to load video", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load video: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if video == nil {
+		http.NotFound(w, r)
+		return
+	}
 
 	tmpl, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("web/templates/layout.html", "web/templates/video-summary.html")
 	if err != nil {
@@ -188,21 +430,60 @@ func (h *Handler) handleVideoByIDSummary(w http.ResponseWriter, r *http.Request)
 		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
 		return
 	}
-	tmpl.Execute(w, map[string]string{"Title": "Video", "VideoID": videoID, "Summary": summary})
+	tmpl.Execute(w, map[string]interface{}{"Title": "Video", "VideoID": videoID, "VideoTitle": video.Title, "Video": video, "Summary": summary})
 }
 
 func (h *Handler) handleProcessVideo(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
 	videoID := r.FormValue("videoID")
-	model := r.FormValue("model")
-	pattern := r.FormValue("pattern")
-	h.logger.Debug("Handling /process-video request", "videoID", videoID, "model", model, "pattern", pattern)
+	models := r.Form["model"]
+	patterns := r.Form["pattern"]
+	if len(models) == 0 {
+		models = []string{"default"}
+	}
+	h.logger.Debug("Handling /process-video request", "videoID", videoID, "models", models, "patterns", patterns)
+	if !h.processor.ValidVideoID(videoID) {
+		http.Error(w, fmt.Sprintf("Invalid video ID %q", videoID), http.StatusBadRequest)
+		return
+	}
+
+	// Several models or patterns fan out into one job that lands on the compare view
+	if len(models) > 1 || len(patterns) > 1 {
+		job, err := h.processor.EnqueueFanOut(videoID, models, patterns)
+		if err != nil {
+			h.logger.Error("Failed to queue video processing", "videoID", videoID, "models", models, "patterns", patterns, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to queue video processing: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("HX-Redirect", "/jobs/"+job.ID)
+		return
+	}
+	if len(patterns) == 0 {
+		http.Error(w, "Select a pattern", http.StatusBadRequest)
+		return
+	}
+
+	model, pattern := models[0], patterns[0]
+	job, err := h.processor.EnqueueProcess(videoID, model, pattern)
+	if err != nil {
+		h.logger.Error("Failed to queue video processing", "videoID", videoID, "model", model, "pattern", pattern, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to queue video processing: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, `<li><a href="/jobs/%s" class="text-indigo-400 hover:text-indigo-300 transition duration-150 ease-in-out">%s</a> <span class="text-gray-500 text-sm">%s &middot; queued</span></li>`,
+		job.ID, template.HTMLEscapeString(pattern), template.HTMLEscapeString(model))
+}
+
+func (h *Handler) handleRefetchTranscript(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+	language, kind, _ := strings.Cut(r.FormValue("track"), ":")
+	h.logger.Debug("Handling /videos/{id}/transcript request", "videoID", videoID, "language", language, "kind", kind)
 
-	_, _, err := h.processor.ProcessVideo(videoID, model, pattern)
+	_, err := h.processor.RefetchTranscript(videoID, language, kind)
 	if err != nil {
-		h.logger.Error("Failed to process video", "videoID", videoID, "model", model, "pattern", pattern, "error", err)
-		http.Error(w, fmt.Sprintf("Failed to process video: %v", err), http.StatusInternalServerError)
+		h.logger.Error("Failed to refetch transcript", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to refetch transcript: %v", err), http.StatusInternalServerError)
 		return
 	}
-	videoLink := fmt.Sprintf("/videos/%s/%s-%s.md", videoID, pattern, model)
-	fmt.Fprintf(w, `<li><a href="%s" class="text-indigo-400 hover:text-indigo-300 transition duration-150 ease-in-out">%s-%s.md</a></li>`, videoLink, pattern, model)
+	w.Header().Set("HX-Refresh", "true")
 }
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"fabric-agents/core"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	h.logger.Debug("Handling /jobs request")
+	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/jobs.html", "web/templates/job-state.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{"Title": "Jobs", "Jobs": h.jobs.List()})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
+
+func (h *Handler) handleJobByID(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	h.logger.Debug("Handling /jobs/{id} request", "jobID", jobID)
+	job, ok := h.jobs.Get(jobID)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/job.html", "web/templates/job-state.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{"Title": "Job", "Job": job})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
+
+func (h *Handler) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	h.logger.Info("Cancelling job", "jobID", jobID)
+	if err := h.jobs.Cancel(jobID); err != nil {
+		h.logger.Error("Failed to cancel job", "jobID", jobID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to cancel job: %v", err), http.StatusConflict)
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
+
+// handleJobEvents streams a job's output as Server-Sent Events. Each "output"
+// event carries the text generated since the previous one; a final "done" or
+// "failed" event carries the result link or the error.
+func (h *Handler) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	h.logger.Debug("Handling /jobs/{id}/events request", "jobID", jobID)
+	if _, ok := h.jobs.Get(jobID); !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	updates, stop := h.jobs.Watch(jobID)
+	defer stop()
+
+	sent := 0
+	for {
+		job, _ := h.jobs.Get(jobID)
+		output := h.jobs.Output(jobID)
+		if len(output) > sent {
+			writeEvent(w, "output", output[sent:])
+			sent = len(output)
+		}
+		switch job.State {
+		case core.JobSucceeded:
+			writeEvent(w, "done", job.Result)
+		case core.JobFailed, core.JobCancelled:
+			writeEvent(w, "failed", string(job.State)+": "+job.Error)
+		}
+		flusher.Flush()
+		if job.State.Done() {
+			return
+		}
+
+		select {
+		case <-updates:
+		case <-time.After(15 * time.Second):
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one SSE event, splitting multi-line data across data fields
+func writeEvent(w io.Writer, event string, data string) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,127 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"fabric-agents/core"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handlePipelines(w http.ResponseWriter, r *http.Request) {
+	h.logger.Debug("Handling /pipelines request", "method", r.Method)
+
+	if r.Method == "POST" {
+		name := strings.TrimSpace(r.FormValue("name"))
+		steps, err := core.ParsePipelineSteps(r.FormValue("steps"))
+		if err == nil {
+			err = h.processor.SavePipeline(core.Pipeline{Name: name, Steps: steps})
+		}
+		if err != nil {
+			h.logger.Error("Failed to save pipeline", "name", name, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to save pipeline: %v", err), http.StatusBadRequest)
+			return
+		}
+		h.logger.Info("Pipeline saved", "name", name, "steps", len(steps))
+		w.Header().Set("HX-Refresh", "true")
+		return
+	}
+
+	pipelines, err := h.processor.LoadPipelines()
+	if err != nil {
+		h.logger.Error("Failed to load pipelines", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load pipelines: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/pipelines.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{"Title": "Pipelines", "Pipelines": pipelines})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
+
+func (h *Handler) handlePipelineByName(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.logger.Info("Deleting pipeline", "name", name)
+	if err := h.processor.DeletePipeline(name); err != nil {
+		h.logger.Error("Failed to delete pipeline", "name", name, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to delete pipeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
+
+func (h *Handler) handleRunPipeline(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+	name := r.FormValue("pipeline")
+	h.logger.Debug("Handling /videos/{id}/pipelines request", "videoID", videoID, "pipeline", name)
+
+	job, err := h.processor.EnqueuePipeline(videoID, name)
+	if err != nil {
+		h.logger.Error("Failed to queue pipeline", "videoID", videoID, "pipeline", name, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to queue pipeline: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/jobs/"+job.ID)
+}
+
+func (h *Handler) handlePipelineRun(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	videoID, runID := vars["id"], vars["runID"]
+	h.logger.Debug("Handling /videos/{id}/pipelines/{runID} request", "videoID", videoID, "runID", runID)
+
+	video, err := h.store.LoadVideo(videoID)
+	if err != nil || video == nil {
+		h.logger.Error("Failed to load video", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load video: %v", err), http.StatusNotFound)
+		return
+	}
+	run, err := core.LoadPipelineRun(videoID, runID, h.dataDir)
+	if err != nil {
+		h.logger.Error("Failed to load pipeline run", "videoID", videoID, "runID", runID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load pipeline run: %v", err), http.StatusNotFound)
+		return
+	}
+
+	outputs := make([]string, len(run.Steps))
+	for i, step := range run.Steps {
+		if step.RunID == "" || step.Error != "" {
+			continue
+		}
+		outputs[i], err = h.store.LoadRunOutput(videoID, step.RunID)
+		if err != nil {
+			h.logger.Warn("Failed to load pipeline step output", "videoID", videoID, "step", i+1, "error", err)
+		}
+	}
+
+	tmpl, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("web/templates/layout.html", "web/templates/pipeline-run.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Title":   "Pipeline Run",
+		"VideoID": videoID,
+		"Video":   video,
+		"Run":     run,
+		"Outputs": outputs,
+	})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
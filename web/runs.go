@@ -0,0 +1,61 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"fabric-agents/core"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleRunByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	videoID, runID := vars["id"], vars["runID"]
+	h.logger.Debug("Handling /videos/{id}/runs/{runID} request", "videoID", videoID, "runID", runID)
+
+	video, err := h.store.LoadVideo(videoID)
+	if err != nil || video == nil {
+		h.logger.Error("Failed to load video", "videoID", videoID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load video: %v", err), http.StatusNotFound)
+		return
+	}
+	run, err := h.store.LoadRun(videoID, runID)
+	if err != nil {
+		h.logger.Error("Failed to load run", "videoID", videoID, "runID", runID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load run: %v", err), http.StatusNotFound)
+		return
+	}
+	var output string
+	if run.Status == core.RunSucceeded {
+		output, err = h.store.LoadRunOutput(videoID, runID)
+		if err != nil {
+			h.logger.Error("Failed to load run output", "videoID", videoID, "runID", runID, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to load run output: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	chunks, err := h.store.LoadRunChunks(videoID, runID)
+	if err != nil {
+		h.logger.Warn("Failed to load run chunks", "videoID", videoID, "runID", runID, "error", err)
+	}
+
+	tmpl, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("web/templates/layout.html", "web/templates/run.html", "web/templates/job-state.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Title":   "Run",
+		"VideoID": videoID,
+		"Video":   video,
+		"Run":     run,
+		"Output":  output,
+		"Chunks":  chunks,
+	})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
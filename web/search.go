@@ -0,0 +1,49 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"fabric-agents/core"
+)
+
+// searchLimit caps how many hits the search page shows
+const searchLimit = 50
+
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	h.logger.Debug("Handling /search request", "query", query)
+
+	semantic := r.URL.Query().Get("mode") == "semantic" && h.processor.SemanticSearchEnabled()
+
+	var hits []core.SearchHit
+	var searchErr error
+	if query != "" {
+		if semantic {
+			hits, searchErr = h.processor.SemanticSearch(r.Context(), query, searchLimit)
+			if searchErr != nil {
+				h.logger.Error("Semantic search failed", "query", query, "error", searchErr)
+			}
+		} else {
+			hits = h.processor.Search(query, searchLimit)
+		}
+	}
+	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/search.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, map[string]interface{}{
+		"Title":           "Search",
+		"Query":           query,
+		"Hits":            hits,
+		"Error":           searchErr,
+		"Semantic":        semantic,
+		"SemanticEnabled": h.processor.SemanticSearchEnabled(),
+	}); err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
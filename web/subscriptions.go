@@ -0,0 +1,86 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	h.logger.Debug("Handling /subscriptions request", "method", r.Method)
+
+	if r.Method == "POST" {
+		channel := r.FormValue("channel")
+		_, err := h.subscriptions.Subscribe(channel, r.FormValue("pattern"), r.FormValue("model"))
+		if err != nil {
+			h.logger.Error("Failed to subscribe", "channel", channel, "error", err)
+			http.Error(w, fmt.Sprintf("Failed to subscribe: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("HX-Refresh", "true")
+		return
+	}
+
+	subs, err := h.subscriptions.List()
+	if err != nil {
+		h.logger.Error("Failed to load subscriptions", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load subscriptions: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// The auto-run selects are optional, so a missing fabric install only empties them
+	patterns, err := h.processor.ListPatterns(r.Context())
+	if err != nil {
+		h.logger.Warn("Failed to load patterns", "error", err)
+	}
+	models, err := h.processor.ListModels(r.Context())
+	if err != nil {
+		h.logger.Warn("Failed to load models", "error", err)
+	}
+
+	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/subscriptions.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Title":         "Subscriptions",
+		"Subscriptions": subs,
+		"AllPatterns":   patterns,
+		"AllModels":     models,
+	})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
+
+func (h *Handler) handleSubscriptionByID(w http.ResponseWriter, r *http.Request) {
+	channelID := mux.Vars(r)["id"]
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.logger.Info("Unsubscribing", "channelID", channelID)
+	if err := h.subscriptions.Unsubscribe(channelID); err != nil {
+		h.logger.Error("Failed to unsubscribe", "channelID", channelID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to unsubscribe: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
+
+func (h *Handler) handlePollSubscription(w http.ResponseWriter, r *http.Request) {
+	channelID := mux.Vars(r)["id"]
+	h.logger.Debug("Handling /subscriptions/{id}/poll request", "channelID", channelID)
+
+	job, err := h.subscriptions.EnqueuePoll(channelID)
+	if err != nil {
+		h.logger.Error("Failed to queue poll", "channelID", channelID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to queue poll: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/jobs/"+job.ID)
+}
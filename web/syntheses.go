@@ -0,0 +1,72 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleSyntheses(w http.ResponseWriter, r *http.Request) {
+	h.logger.Debug("Handling /syntheses request", "method", r.Method)
+
+	if r.Method == "POST" {
+		r.ParseForm()
+		videos, err := h.selectedVideos(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		videoIDs := make([]string, 0, len(videos))
+		for _, video := range videos {
+			videoIDs = append(videoIDs, video.ID)
+		}
+		job, err := h.processor.EnqueueSynthesis(r.FormValue("title"), videoIDs, r.FormValue("pattern"), r.FormValue("model"), r.FormValue("from"))
+		if err != nil {
+			h.logger.Error("Failed to queue synthesis", "error", err)
+			http.Error(w, fmt.Sprintf("Failed to queue synthesis: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("HX-Redirect", "/jobs/"+job.ID)
+		return
+	}
+
+	syntheses, err := h.processor.LoadSyntheses()
+	if err != nil {
+		h.logger.Error("Failed to load syntheses", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load syntheses: %v", err), http.StatusInternalServerError)
+		return
+	}
+	tmpl, err := template.ParseFiles("web/templates/layout.html", "web/templates/syntheses.html", "web/templates/job-state.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, map[string]interface{}{"Title": "Syntheses", "Syntheses": syntheses}); err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
+
+func (h *Handler) handleSynthesisByID(w http.ResponseWriter, r *http.Request) {
+	synthesisID := mux.Vars(r)["id"]
+	h.logger.Debug("Handling /syntheses/{id} request", "synthesisID", synthesisID)
+
+	synthesis, output, err := h.processor.LoadSynthesis(synthesisID)
+	if err != nil {
+		h.logger.Error("Failed to load synthesis", "synthesisID", synthesisID, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to load synthesis: %v", err), http.StatusNotFound)
+		return
+	}
+	tmpl, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("web/templates/layout.html", "web/templates/synthesis.html", "web/templates/job-state.html")
+	if err != nil {
+		h.logger.Error("Failed to parse template", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{"Title": synthesis.Title, "Synthesis": synthesis, "Output": output})
+	if err != nil {
+		h.logger.Error("Failed to execute template", "error", err)
+	}
+}
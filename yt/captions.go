@@ -0,0 +1,151 @@
+package yt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anaskhan96/soup"
+)
+
+// DefaultCaptionPreferences is the caption track preference order used when none is configured
+const DefaultCaptionPreferences = "manual en, manual any, asr en, asr any"
+
+// CaptionTrack describes one of the caption tracks a video offers
+type CaptionTrack struct {
+	BaseURL      string `json:"-"`
+	LanguageCode string `json:"language_code"`
+	Kind         string `json:"kind,omitempty"`
+	Name         string `json:"name"`
+}
+
+// KindLabel returns "asr" for auto-generated tracks and "manual" for everything else
+func (t CaptionTrack) KindLabel() string {
+	if t.Kind == "asr" {
+		return "asr"
+	}
+	return "manual"
+}
+
+// CaptionPreference matches caption tracks by kind ("manual" or "asr") and
+// language code. An empty field matches any value. A language matches its
+// regional variants too, "en" matching "en-GB", unless Exact is set.
+type CaptionPreference struct {
+	Kind     string
+	Language string
+	Exact    bool
+}
+
+func (p CaptionPreference) matches(track CaptionTrack) bool {
+	if p.Kind != "" && p.Kind != track.KindLabel() {
+		return false
+	}
+	if p.Language == "" {
+		return true
+	}
+	code := strings.ToLower(track.LanguageCode)
+	lang := strings.ToLower(p.Language)
+	return code == lang || !p.Exact && strings.HasPrefix(code, lang+"-")
+}
+
+// ParseCaptionPreferences parses a comma separated preference list such as
+// "manual en, manual any, asr en, asr any". Each entry is a kind followed by
+// an optional language code; "any" or "*" match everything, in any case.
+func ParseCaptionPreferences(s string) ([]CaptionPreference, error) {
+	var prefs []CaptionPreference
+	for _, entry := range strings.Split(s, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid caption preference %q", strings.TrimSpace(entry))
+		}
+		var pref CaptionPreference
+		switch kind := strings.ToLower(fields[0]); kind {
+		case "manual", "asr":
+			pref.Kind = kind
+		case "any", "*":
+		default:
+			return nil, fmt.Errorf("invalid caption kind %q", fields[0])
+		}
+		if len(fields) == 2 && !strings.EqualFold(fields[1], "any") && fields[1] != "*" {
+			pref.Language = fields[1]
+		}
+		prefs = append(prefs, pref)
+	}
+	if len(prefs) == 0 {
+		return nil, fmt.Errorf("no caption preferences given")
+	}
+	return prefs, nil
+}
+
+// SelectCaptionTrack returns the first track matching the earliest preference
+func SelectCaptionTrack(tracks []CaptionTrack, prefs []CaptionPreference) (CaptionTrack, bool) {
+	for _, pref := range prefs {
+		for _, track := range tracks {
+			if pref.matches(track) {
+				return track, true
+			}
+		}
+	}
+	return CaptionTrack{}, false
+}
+
+// getCaptionTracks extracts the caption track list from the player response embedded in the watch page
+func getCaptionTracks(doc soup.Root) ([]CaptionTrack, error) {
+	const marker = `"captionTracks":`
+	for _, scriptTag := range doc.FindAll("script") {
+		text := scriptTag.Text()
+		idx := strings.Index(text, marker)
+		if idx < 0 {
+			continue
+		}
+
+		var rawTracks []struct {
+			BaseURL      string `json:"baseUrl"`
+			LanguageCode string `json:"languageCode"`
+			Kind         string `json:"kind"`
+			Name         struct {
+				SimpleText string `json:"simpleText"`
+				Runs       []struct {
+					Text string `json:"text"`
+				} `json:"runs"`
+			} `json:"name"`
+		}
+		decoder := json.NewDecoder(strings.NewReader(text[idx+len(marker):]))
+		if err := decoder.Decode(&rawTracks); err != nil {
+			return nil, fmt.Errorf("error parsing caption tracks: %v", err)
+		}
+
+		tracks := make([]CaptionTrack, 0, len(rawTracks))
+		for _, raw := range rawTracks {
+			name := raw.Name.SimpleText
+			if name == "" {
+				for _, run := range raw.Name.Runs {
+					name += run.Text
+				}
+			}
+			tracks = append(tracks, CaptionTrack{
+				BaseURL:      raw.BaseURL,
+				LanguageCode: raw.LanguageCode,
+				Kind:         raw.Kind,
+				Name:         name,
+			})
+		}
+		return tracks, nil
+	}
+	return nil, fmt.Errorf("transcript not found")
+}
+
+func fetchCaptionTrack(track CaptionTrack) ([]Segment, error) {
+	resp, err := soup.Get(track.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	transcript, err := unmarshalTranscript([]byte(resp))
+	if err != nil {
+		return nil, err
+	}
+	return transcript.Segments(), nil
+}
@@ -0,0 +1,70 @@
+package yt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCaptionPreferences(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []CaptionPreference
+		wantErr bool
+	}{
+		{in: DefaultCaptionPreferences, want: []CaptionPreference{
+			{Kind: "manual", Language: "en"},
+			{Kind: "manual"},
+			{Kind: "asr", Language: "en"},
+			{Kind: "asr"},
+		}},
+		{in: "MANUAL de, ASR ANY", want: []CaptionPreference{{Kind: "manual", Language: "de"}, {Kind: "asr"}}},
+		{in: "any en-GB", want: []CaptionPreference{{Language: "en-GB"}}},
+		{in: " * , asr * ,", want: []CaptionPreference{{}, {Kind: "asr"}}},
+		{in: "", wantErr: true},
+		{in: " , ", wantErr: true},
+		{in: "subtitles en", wantErr: true},
+		{in: "manual en extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCaptionPreferences(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseCaptionPreferences(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCaptionPreferences(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestSelectCaptionTrack(t *testing.T) {
+	tracks := []CaptionTrack{
+		{LanguageCode: "de", Kind: "asr", Name: "German (auto-generated)"},
+		{LanguageCode: "en-GB", Name: "English (UK)"},
+		{LanguageCode: "fr", Name: "French"},
+	}
+	tests := []struct {
+		name   string
+		prefs  []CaptionPreference
+		want   string
+		wantOK bool
+	}{
+		{"earliest preference wins", []CaptionPreference{{Kind: "manual", Language: "fr"}, {Kind: "manual"}}, "fr", true},
+		{"kind", []CaptionPreference{{Kind: "asr"}}, "de", true},
+		{"language matches regional variant", []CaptionPreference{{Kind: "manual", Language: "EN"}}, "en-GB", true},
+		{"exact language skips regional variant", []CaptionPreference{{Kind: "manual", Language: "en", Exact: true}}, "", false},
+		{"exact language", []CaptionPreference{{Kind: "manual", Language: "en-gb", Exact: true}}, "en-GB", true},
+		{"prefix is not a language", []CaptionPreference{{Language: "e"}}, "", false},
+		{"kind mismatch", []CaptionPreference{{Kind: "asr", Language: "fr"}}, "", false},
+		{"any track", []CaptionPreference{{}}, "de", true},
+		{"no preferences", nil, "", false},
+	}
+	for _, tt := range tests {
+		track, ok := SelectCaptionTrack(tracks, tt.prefs)
+		if ok != tt.wantOK || track.LanguageCode != tt.want {
+			t.Errorf("%s: got %q, %v; want %q, %v", tt.name, track.LanguageCode, ok, tt.want, tt.wantOK)
+		}
+	}
+}
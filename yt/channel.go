@@ -0,0 +1,100 @@
+package yt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/anaskhan96/soup"
+)
+
+var (
+	channelIDRegex       = regexp.MustCompile(`^UC[a-zA-Z0-9_-]{22}$`)
+	channelURLRegex      = regexp.MustCompile(`youtube\.com\/channel\/(UC[a-zA-Z0-9_-]{22})`)
+	channelHandleRegex   = regexp.MustCompile(`^(?:(?:https?:\/\/)?(?:www\.|m\.)?youtube\.com\/)?(@[\w.-]+|c\/[\w.-]+|user\/[\w.-]+)\/?`)
+	channelExternalRegex = regexp.MustCompile(`"externalId":"(UC[a-zA-Z0-9_-]{22})"`)
+)
+
+// ChannelFeed is the public Atom feed of a channel's most recent uploads
+type ChannelFeed struct {
+	ChannelID string
+	Title     string
+	Entries   []FeedEntry
+}
+
+// FeedEntry is a single upload listed in a channel feed
+type FeedEntry struct {
+	VideoID   string
+	Title     string
+	URL       string
+	Published time.Time
+}
+
+// ResolveChannelID accepts a channel ID, channel URL, @handle or handle URL and returns the channel ID
+func (y *YT) ResolveChannelID(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if channelIDRegex.MatchString(input) {
+		return input, nil
+	}
+	if match := channelURLRegex.FindStringSubmatch(input); len(match) > 1 {
+		return match[1], nil
+	}
+
+	match := channelHandleRegex.FindStringSubmatch(input)
+	if len(match) < 2 {
+		return "", fmt.Errorf("unrecognised channel %q", input)
+	}
+	resp, err := soup.Get("https://www.youtube.com/" + match[1])
+	if err != nil {
+		return "", err
+	}
+	if idMatch := channelExternalRegex.FindStringSubmatch(resp); len(idMatch) > 1 {
+		return idMatch[1], nil
+	}
+	return "", fmt.Errorf("channel ID not found for %q", input)
+}
+
+// ChannelURL returns the channel page link for a channel ID
+func (y *YT) ChannelURL(channelID string) string {
+	return "https://www.youtube.com/channel/" + channelID
+}
+
+// GetChannelFeed fetches the channel's public uploads feed, newest entries first
+func (y *YT) GetChannelFeed(channelID string) (*ChannelFeed, error) {
+	resp, err := soup.Get("https://www.youtube.com/feeds/videos.xml?channel_id=" + channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed struct {
+		Title   string `xml:"title"`
+		Entries []struct {
+			VideoID   string    `xml:"http://www.youtube.com/xml/schemas/2015 videoId"`
+			Title     string    `xml:"title"`
+			Published time.Time `xml:"published"`
+			Link      struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal([]byte(resp), &feed); err != nil {
+		return nil, fmt.Errorf("error parsing channel feed: %v", err)
+	}
+
+	output := &ChannelFeed{ChannelID: channelID, Title: feed.Title}
+	for _, entry := range feed.Entries {
+		url := entry.Link.Href
+		if url == "" {
+			url = y.VideoURL(entry.VideoID)
+		}
+		output.Entries = append(output.Entries, FeedEntry{
+			VideoID:   entry.VideoID,
+			Title:     entry.Title,
+			URL:       url,
+			Published: entry.Published,
+		})
+	}
+	return output, nil
+}
@@ -2,9 +2,9 @@ package yt
 
 import (
 	"context"
-	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"html"
 	"log"
 	"regexp"
 	"strconv"
@@ -16,18 +16,31 @@ import (
 )
 
 type YT struct {
-	apiKey  string
-	service *youtube.Service
+	apiKey       string
+	service      *youtube.Service
+	captionPrefs []CaptionPreference
 }
 
 type Video struct {
-	ID         string   `json:"id"`
-	Title      string   `json:"title"`
-	Channel    string   `json:"channel"`
-	Transcript string   `json:"transcript"`
-	Comments   []string `json:"comments"`
-	Duration   int      `json:"duration"`
-	URL        string   `json:"url"`
+	ID         string    `json:"id"`
+	Source     string    `json:"source,omitempty"`
+	Title      string    `json:"title"`
+	Channel    string    `json:"channel"`
+	Transcript string    `json:"transcript"`
+	Segments   []Segment `json:"segments,omitempty"`
+	Comments   []string  `json:"comments"`
+	Duration   int       `json:"duration"`
+	URL        string    `json:"url"`
+
+	CaptionTrack  *CaptionTrack  `json:"caption_track,omitempty"`
+	CaptionTracks []CaptionTrack `json:"caption_tracks,omitempty"`
+}
+
+// Segment is a single timed line of a transcript. Start and Duration are in seconds.
+type Segment struct {
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	Text     string  `json:"text"`
 }
 
 func NewYT(apiKey string) *YT {
@@ -41,10 +54,34 @@ func NewYT(apiKey string) *YT {
 			log.Fatalf("Error creating YouTube client: %v", err)
 		}
 	}
-	return &YT{apiKey: apiKey, service: service}
+	prefs, _ := ParseCaptionPreferences(DefaultCaptionPreferences)
+	return &YT{apiKey: apiKey, service: service, captionPrefs: prefs}
+}
+
+// SetCaptionPreferences sets the order in which caption tracks are tried
+func (y *YT) SetCaptionPreferences(prefs []CaptionPreference) {
+	y.captionPrefs = prefs
+}
+
+// SourceName is the Video.Source value for videos fetched from YouTube
+const SourceName = "youtube"
+
+// Name returns the source name recorded on fetched videos
+func (y *YT) Name() string {
+	return SourceName
+}
+
+// VideoURL returns the watch page link for a video ID
+func (y *YT) VideoURL(videoID string) string {
+	return "https://www.youtube.com/watch?v=" + videoID
 }
 
 func (y *YT) GetVideoInfo(url string) (*Video, error) {
+	return y.GetVideoInfoWithCaptions(url, y.captionPrefs)
+}
+
+// GetVideoInfoWithCaptions fetches a video using the given caption preferences instead of the configured ones
+func (y *YT) GetVideoInfoWithCaptions(url string, prefs []CaptionPreference) (*Video, error) {
 	fmt.Println("Getting video info for", url)
 	videoID := y.GetVideoID(url)
 	if videoID == "" {
@@ -52,19 +89,31 @@ func (y *YT) GetVideoInfo(url string) (*Video, error) {
 	}
 
 	output := &Video{
-		ID: videoID,
+		ID:     videoID,
+		Source: SourceName,
+		URL:    y.VideoURL(videoID),
 	}
-	videoDetails, err := y.getVideoDetails(videoID)
+	videoDetails, err := y.getVideoDetails(videoID, prefs)
 	if err != nil {
 		fmt.Println("Error:", err)
 		return nil, err
 	}
-	output.Transcript = videoDetails["transcript"]
-	output.Title = videoDetails["title"]
-	output.Channel = videoDetails["channel"]
+	output.Transcript = videoDetails.transcript
+	output.Segments = videoDetails.segments
+	output.Title = videoDetails.title
+	output.Channel = videoDetails.channel
+	output.CaptionTrack = &videoDetails.track
+	output.CaptionTracks = videoDetails.tracks
 	return output, nil
 }
 
+var videoIDRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{11}$`)
+
+// ValidVideoID reports whether videoID has the form of a YouTube video ID
+func (y *YT) ValidVideoID(videoID string) bool {
+	return videoIDRegex.MatchString(videoID)
+}
+
 func (y *YT) GetVideoID(url string) string {
 	pattern := `(?:https?:\/\/)?(?:www\.)?(?:youtube\.com\/(?:[^\/\n\s]+\/\S+\/|(?:v|e(?:mbed)?)\/|\S*?[?&]v=)|youtu\.be\/)([a-zA-Z0-9_-]{11})`
 	re := regexp.MustCompile(pattern)
@@ -75,65 +124,53 @@ func (y *YT) GetVideoID(url string) string {
 	return ""
 }
 
-func (y *YT) getVideoDetails(videoID string) (map[string]string, error) {
-	url := "https://www.youtube.com/watch?v=" + videoID
-	resp, err := soup.Get(url)
+type videoDetails struct {
+	title      string
+	channel    string
+	transcript string
+	segments   []Segment
+	track      CaptionTrack
+	tracks     []CaptionTrack
+}
+
+func (y *YT) getVideoDetails(videoID string, prefs []CaptionPreference) (*videoDetails, error) {
+	resp, err := soup.Get(y.VideoURL(videoID))
 	if err != nil {
 		return nil, err
 	}
 
 	doc := soup.HTMLParse(resp)
 
-	transcript, err := y.getTranscript(doc)
+	tracks, err := getCaptionTracks(doc)
+	if err != nil {
+		return nil, err
+	}
+	track, ok := SelectCaptionTrack(tracks, prefs)
+	if !ok {
+		return nil, fmt.Errorf("no caption track matches the preferred languages")
+	}
+	segments, err := fetchCaptionTrack(track)
 	if err != nil {
 		return nil, err
 	}
-	title := getTitle(doc)
-	channel := getCreator(doc)
 
-	return map[string]string{
-		"transcript": transcript,
-		"title":      title,
-		"channel":    channel,
+	return &videoDetails{
+		title:      getTitle(doc),
+		channel:    getCreator(doc),
+		transcript: JoinSegments(segments),
+		segments:   segments,
+		track:      track,
+		tracks:     tracks,
 	}, nil
 }
 
-func (y *YT) getTranscript(doc soup.Root) (string, error) {
-	scriptTags := doc.FindAll("script")
-	for _, scriptTag := range scriptTags {
-		if strings.Contains(scriptTag.Text(), "captionTracks") {
-			regex := regexp.MustCompile(`"captionTracks":(\[.*?\])`)
-			match := regex.FindStringSubmatch(scriptTag.Text())
-			if len(match) > 1 {
-				var captionTracks []struct {
-					BaseURL string `json:"baseUrl"`
-				}
-				json.Unmarshal([]byte(match[1]), &captionTracks)
-				if len(captionTracks) > 0 {
-					transcriptURL := captionTracks[0].BaseURL
-					transcriptResp, err := soup.Get(transcriptURL)
-
-					if err != nil {
-						return "", err
-					}
-					transcript, err := unmarshalTranscript([]byte(transcriptResp))
-					if err != nil {
-						return "", err
-					}
-					var transcriptLines []string
-					for _, track := range transcript.Texts {
-						cleanedText := strings.ReplaceAll(track.Value, "&#39;", "'")
-						transcriptLines = append(transcriptLines, cleanedText)
-					}
-
-					cleanedTranscript := strings.Join(transcriptLines, " ")
-					cleanedTranscript = cleanedTranscript + "\n"
-					return cleanedTranscript, nil
-				}
-			}
-		}
+// JoinSegments flattens transcript segments into the plain text stored in Video.Transcript.
+func JoinSegments(segments []Segment) string {
+	lines := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		lines = append(lines, segment.Text)
 	}
-	return "", fmt.Errorf("transcript not found")
+	return strings.Join(lines, " ") + "\n"
 }
 
 func getTitle(doc soup.Root) string {
@@ -213,6 +250,21 @@ type Text struct {
 	Value string `xml:",chardata"`
 }
 
+// Segments converts the raw caption texts into timed segments
+func (t *Transcript) Segments() []Segment {
+	segments := make([]Segment, 0, len(t.Texts))
+	for _, text := range t.Texts {
+		start, _ := strconv.ParseFloat(text.Start, 64)
+		dur, _ := strconv.ParseFloat(text.Dur, 64)
+		segments = append(segments, Segment{
+			Start:    start,
+			Duration: dur,
+			Text:     html.UnescapeString(text.Value),
+		})
+	}
+	return segments
+}
+
 func unmarshalTranscript(xmlData []byte) (*Transcript, error) {
 	var transcript Transcript
 	err := xml.Unmarshal(xmlData, &transcript)
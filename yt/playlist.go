@@ -0,0 +1,67 @@
+package yt
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/anaskhan96/soup"
+)
+
+var (
+	playlistIDRegex      = regexp.MustCompile(`(?:youtube\.com|youtu\.be)\/\S*?[?&]list=([a-zA-Z0-9_-]+)`)
+	playlistVideoIDRegex = regexp.MustCompile(`"playlistVideoRenderer":\{"videoId":"([a-zA-Z0-9_-]{11})"`)
+)
+
+// Playlist is a YouTube playlist and the IDs of the videos in it
+type Playlist struct {
+	ID       string
+	Title    string
+	URL      string
+	VideoIDs []string
+}
+
+// GetPlaylistID returns the playlist ID carried by a playlist or watch URL, or "" if there is none
+func (y *YT) GetPlaylistID(url string) string {
+	match := playlistIDRegex.FindStringSubmatch(url)
+	if len(match) > 1 {
+		return match[1]
+	}
+	return ""
+}
+
+// PlaylistURL returns the playlist page link for a playlist ID
+func (y *YT) PlaylistURL(playlistID string) string {
+	return "https://www.youtube.com/playlist?list=" + playlistID
+}
+
+// GetPlaylist scrapes the playlist page for its title and member videos.
+// Only the videos rendered on the first page (up to 100) are returned.
+func (y *YT) GetPlaylist(url string) (*Playlist, error) {
+	playlistID := y.GetPlaylistID(url)
+	if playlistID == "" {
+		return nil, fmt.Errorf("invalid YouTube playlist URL")
+	}
+
+	resp, err := soup.Get(y.PlaylistURL(playlistID))
+	if err != nil {
+		return nil, err
+	}
+	doc := soup.HTMLParse(resp)
+
+	playlist := &Playlist{
+		ID:    playlistID,
+		Title: getTitle(doc),
+		URL:   y.PlaylistURL(playlistID),
+	}
+	seen := make(map[string]bool)
+	for _, match := range playlistVideoIDRegex.FindAllStringSubmatch(resp, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			playlist.VideoIDs = append(playlist.VideoIDs, match[1])
+		}
+	}
+	if len(playlist.VideoIDs) == 0 {
+		return nil, fmt.Errorf("no videos found in playlist %s", playlistID)
+	}
+	return playlist, nil
+}
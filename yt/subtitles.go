@@ -0,0 +1,136 @@
+package yt
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// utf8BOM is the byte order mark some editors start subtitle files with
+const utf8BOM = "\xef\xbb\xbf"
+
+var (
+	cueTimingRegex = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+	cueTagRegex    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseSubtitles parses an SRT, WebVTT or YouTube transcript XML file into
+// segments. The format is chosen by file extension and falls back to
+// sniffing the content.
+func ParseSubtitles(filename string, data []byte) ([]Segment, error) {
+	data = bytes.TrimPrefix(data, []byte(utf8BOM))
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".srt":
+		return ParseSRT(data)
+	case ".vtt":
+		return ParseVTT(data)
+	case ".xml":
+		return ParseTranscriptXML(data)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("WEBVTT")):
+		return ParseVTT(data)
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return ParseTranscriptXML(data)
+	default:
+		return ParseSRT(data)
+	}
+}
+
+// ParseSRT parses SubRip subtitles
+func ParseSRT(data []byte) ([]Segment, error) {
+	segments := parseCues(string(data))
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("no subtitle cues found")
+	}
+	return segments, nil
+}
+
+// ParseVTT parses WebVTT subtitles
+func ParseVTT(data []byte) ([]Segment, error) {
+	text := strings.TrimSpace(strings.TrimPrefix(string(data), utf8BOM))
+	if !strings.HasPrefix(text, "WEBVTT") {
+		return nil, fmt.Errorf("missing WEBVTT header")
+	}
+	segments := parseCues(text)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("no subtitle cues found")
+	}
+	return segments, nil
+}
+
+// ParseTranscriptXML parses the timed text XML served for YouTube caption tracks
+func ParseTranscriptXML(data []byte) ([]Segment, error) {
+	transcript, err := unmarshalTranscript(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing transcript XML: %v", err)
+	}
+	if len(transcript.Texts) == 0 {
+		return nil, fmt.Errorf("no subtitle cues found")
+	}
+	return transcript.Segments(), nil
+}
+
+// parseCues reads SRT and WebVTT style cue blocks. Blocks without a timing
+// line (headers, cue numbers, NOTE and STYLE blocks) are skipped. Cue text
+// loses its markup tags and has its HTML entities decoded.
+func parseCues(text string) []Segment {
+	text = strings.TrimPrefix(text, utf8BOM)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var segments []Segment
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		for i, line := range lines {
+			match := cueTimingRegex.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			start, err := parseCueTime(match[1])
+			if err != nil {
+				break
+			}
+			end, err := parseCueTime(match[2])
+			if err != nil {
+				break
+			}
+
+			var textLines []string
+			for _, textLine := range lines[i+1:] {
+				textLine = strings.TrimSpace(html.UnescapeString(cueTagRegex.ReplaceAllString(textLine, "")))
+				if textLine != "" {
+					textLines = append(textLines, textLine)
+				}
+			}
+			if len(textLines) > 0 {
+				segments = append(segments, Segment{
+					Start:    start,
+					Duration: end - start,
+					Text:     strings.Join(textLines, " "),
+				})
+			}
+			break
+		}
+	}
+	return segments
+}
+
+// parseCueTime parses "HH:MM:SS,mmm", "HH:MM:SS.mmm" or "MM:SS.mmm" into seconds
+func parseCueTime(s string) (float64, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	parts := strings.Split(s, ":")
+	var seconds float64
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
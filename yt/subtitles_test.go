@@ -0,0 +1,160 @@
+package yt
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseCueTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"00:00:01,500", 1.5},
+		{"00:00:01.500", 1.5},
+		{"01:02:03.004", 3723.004},
+		{"02:03.5", 123.5},
+		{"100:00:00.000", 360000},
+	}
+	for _, tt := range tests {
+		got, err := parseCueTime(tt.in)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseCueTime(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseCueTime("00:xx:01.000"); err == nil {
+		t.Error("parseCueTime accepted a malformed timestamp")
+	}
+}
+
+func TestParseSRT(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Segment
+	}{
+		{
+			"basic",
+			"1\n00:00:01,000 --> 00:00:03,500\nHello there.\n\n2\n00:00:04,000 --> 00:00:05,000\nGeneral Kenobi.\n",
+			[]Segment{{Start: 1, Duration: 2.5, Text: "Hello there."}, {Start: 4, Duration: 1, Text: "General Kenobi."}},
+		},
+		{
+			"multi-line cue and CRLF",
+			"1\r\n00:00:01,000 --> 00:00:02,000\r\nFirst line\r\nsecond line\r\n",
+			[]Segment{{Start: 1, Duration: 1, Text: "First line second line"}},
+		},
+		{
+			"tags and entities",
+			"1\n00:00:01,000 --> 00:00:02,000\n<i>Tom &amp; Jerry</i> &lt;3 &quot;cartoons&quot; &#39;n&#39; more\n",
+			[]Segment{{Start: 1, Duration: 1, Text: `Tom & Jerry <3 "cartoons" 'n' more`}},
+		},
+		{
+			"byte order mark",
+			"\xef\xbb\xbf1\n00:00:01,000 --> 00:00:02,000\nHi\n",
+			[]Segment{{Start: 1, Duration: 1, Text: "Hi"}},
+		},
+		{
+			"cue without text is dropped",
+			"1\n00:00:01,000 --> 00:00:02,000\n\n2\n00:00:03,000 --> 00:00:04,000\nKept\n",
+			[]Segment{{Start: 3, Duration: 1, Text: "Kept"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseSRT([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := ParseSRT([]byte("just some text")); err == nil {
+		t.Error("ParseSRT accepted text without cues")
+	}
+}
+
+func TestParseVTT(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Segment
+	}{
+		{
+			"header, note and style blocks",
+			"WEBVTT - a title\n\nNOTE written by hand\n\nSTYLE\n::cue { color: red }\n\n00:01.000 --> 00:02.500\nShort timestamps\n",
+			[]Segment{{Start: 1, Duration: 1.5, Text: "Short timestamps"}},
+		},
+		{
+			"cue identifiers and settings",
+			"WEBVTT\n\nintro\n00:00:01.000 --> 00:00:02.000 align:start position:10% line:0\nWith settings\n",
+			[]Segment{{Start: 1, Duration: 1, Text: "With settings"}},
+		},
+		{
+			"voice and timestamp tags, multi-line",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:03.000\n<v Roger>Hello <00:00:02.000><c>world</c>\nand more\n",
+			[]Segment{{Start: 1, Duration: 2, Text: "Hello world and more"}},
+		},
+		{
+			"entities",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFish &amp; chips&nbsp;&gt; salad\n",
+			[]Segment{{Start: 1, Duration: 1, Text: "Fish & chips\u00a0> salad"}},
+		},
+		{
+			"byte order mark",
+			"\xef\xbb\xbfWEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHi\n",
+			[]Segment{{Start: 1, Duration: 1, Text: "Hi"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseVTT([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := ParseVTT([]byte("00:00:01.000 --> 00:00:02.000\nHi\n")); err == nil {
+		t.Error("ParseVTT accepted a file without the WEBVTT header")
+	}
+}
+
+func TestParseTranscriptXML(t *testing.T) {
+	data := `<?xml version="1.0" encoding="utf-8" ?><transcript>` +
+		`<text start="0.5" dur="1.25">It&amp;#39;s here</text>` +
+		`<text start="2" dur="3">Tom &amp;amp; Jerry</text></transcript>`
+	got, err := ParseTranscriptXML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Segment{{Start: 0.5, Duration: 1.25, Text: "It's here"}, {Start: 2, Duration: 3, Text: "Tom & Jerry"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if _, err := ParseTranscriptXML([]byte(`<transcript></transcript>`)); err == nil {
+		t.Error("ParseTranscriptXML accepted a transcript without text")
+	}
+}
+
+func TestParseSubtitlesSniffsFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     string
+	}{
+		{"captions.srt", "1\n00:00:01,000 --> 00:00:02,000\nHi\n"},
+		{"captions.VTT", "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHi\n"},
+		{"captions.txt", "\xef\xbb\xbfWEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHi\n"},
+		{"captions", `<transcript><text start="1" dur="1">Hi</text></transcript>`},
+		{"captions", "1\n00:00:01,000 --> 00:00:02,000\nHi\n"},
+	}
+	want := []Segment{{Start: 1, Duration: 1, Text: "Hi"}}
+	for _, tt := range tests {
+		got, err := ParseSubtitles(tt.filename, []byte(tt.data))
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseSubtitles(%q) = %+v, %v", tt.filename, got, err)
+		}
+	}
+}